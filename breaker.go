@@ -0,0 +1,97 @@
+package revenium
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// Circuit breaker states reported in Stats.BreakerState.
+const (
+	BreakerClosed   = "closed"
+	BreakerOpen     = "open"
+	BreakerHalfOpen = "half-open"
+)
+
+// errBreakerOpen marks a payload dropped because the circuit breaker is open.
+// Such drops are expected during an outage and are logged at debug level.
+var errBreakerOpen = errors.New("circuit breaker open")
+
+// circuitBreaker stops delivery attempts after a run of consecutive failures.
+// Once the cooldown elapses it lets a single probe through (half-open): a
+// success closes the breaker, a failure reopens it for another cooldown.
+type circuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	mu       sync.Mutex
+	state    string
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+func newCircuitBreaker(threshold int, cooldown time.Duration) *circuitBreaker {
+	return &circuitBreaker{threshold: threshold, cooldown: cooldown, state: BreakerClosed}
+}
+
+// allow reports whether a delivery attempt may proceed.
+func (b *circuitBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case BreakerOpen:
+		if time.Since(b.openedAt) < b.cooldown {
+			return false
+		}
+		b.state = BreakerHalfOpen
+		b.probing = true
+		return true
+	case BreakerHalfOpen:
+		if b.probing {
+			return false
+		}
+		b.probing = true
+		return true
+	default:
+		return true
+	}
+}
+
+// rejecting reports whether the breaker is open and still cooling down, so
+// that allow would refuse an attempt. Unlike allow, it never changes state.
+func (b *circuitBreaker) rejecting() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state == BreakerOpen && time.Since(b.openedAt) < b.cooldown
+}
+
+// record updates the breaker with the outcome of an attempt and returns the
+// state transition, if any, as the new state ("" when unchanged).
+func (b *circuitBreaker) record(success bool) string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+	if success {
+		b.failures = 0
+		if b.state != BreakerClosed {
+			b.state = BreakerClosed
+			return BreakerClosed
+		}
+		return ""
+	}
+	b.failures++
+	if b.state == BreakerHalfOpen || (b.state == BreakerClosed && b.failures >= b.threshold) {
+		b.state = BreakerOpen
+		b.openedAt = time.Now()
+		return BreakerOpen
+	}
+	return ""
+}
+
+// currentState returns the breaker state.
+func (b *circuitBreaker) currentState() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
@@ -0,0 +1,107 @@
+package revenium
+
+import "context"
+
+// billingUnitKey is the context key for a per-call billing unit override.
+type billingUnitKey struct{}
+
+// WithBillingUnit overrides the billing unit for completions metered under the
+// returned context, e.g. to bill a classification call BillingUnitPerRequest in
+// an agent that is otherwise billed per token. The unit must be one of the
+// BillingUnit constants; invalid values are ignored with a warning.
+func WithBillingUnit(ctx context.Context, unit string) context.Context {
+	return context.WithValue(ctx, billingUnitKey{}, unit)
+}
+
+// billingUnit returns the billing unit for a completion metered under ctx.
+func (m *Meter) billingUnit(ctx context.Context) string {
+	unit, _ := ctx.Value(billingUnitKey{}).(string)
+	if unit == "" {
+		return BillingUnitPerToken
+	}
+	if !IsValidBillingUnit(unit) {
+		m.logger.Warn("ignoring invalid billing unit override %q", unit)
+		return BillingUnitPerToken
+	}
+	return unit
+}
+
+// experimentKey is the context key for an experiment assignment.
+type experimentKey struct{}
+
+// experiment is an experiment name and the arm assigned to a call.
+type experiment struct {
+	name, arm string
+}
+
+// WithExperiment tags completions metered under the returned context with an
+// A/B experiment name and arm, reported as the experiment and experimentArm
+// payload fields. Seed it on the context passed to the agent run and it flows
+// to every completion in the run.
+func WithExperiment(ctx context.Context, name, arm string) context.Context {
+	return context.WithValue(ctx, experimentKey{}, experiment{name: name, arm: arm})
+}
+
+// applyExperiment copies the experiment assignment from ctx onto payload
+// unless the payload already names an experiment.
+func applyExperiment(ctx context.Context, payload *MeteringPayload) {
+	exp, ok := ctx.Value(experimentKey{}).(experiment)
+	if !ok || payload.Experiment != "" {
+		return
+	}
+	payload.Experiment = exp.name
+	payload.ExperimentArm = exp.arm
+}
+
+// sessionKey is the context key for a session ID.
+type sessionKey struct{}
+
+// WithSession groups completions metered under the returned context into a
+// session, reported as the sessionId payload field. A session can span many
+// runs (e.g., a multi-turn chat), while the trace ID still correlates a single
+// run. With WithRunSessions, MeteringPlanner falls back to the runtime's
+// session ID when no session is set.
+func WithSession(ctx context.Context, sessionID string) context.Context {
+	return context.WithValue(ctx, sessionKey{}, sessionID)
+}
+
+// sessionID returns the session ID set on ctx with WithSession, or "".
+func sessionID(ctx context.Context) string {
+	id, _ := ctx.Value(sessionKey{}).(string)
+	return id
+}
+
+// modelVariantKey is the context key for a model variant.
+type modelVariantKey struct{}
+
+// WithModelVariant reports variant (e.g., a quantization level such as "int4")
+// as the modelVariant payload field for completions metered under the returned
+// context, so self-hosted deployments of one base model with different cost
+// profiles can be told apart. Leave it unset for hosted APIs.
+func WithModelVariant(ctx context.Context, variant string) context.Context {
+	return context.WithValue(ctx, modelVariantKey{}, variant)
+}
+
+// modelVariant returns the model variant set on ctx with WithModelVariant, or "".
+func modelVariant(ctx context.Context) string {
+	v, _ := ctx.Value(modelVariantKey{}).(string)
+	return v
+}
+
+// captureOutputOnlyKey is the context key for the per-call output-only
+// capture override.
+type captureOutputOnlyKey struct{}
+
+// WithCaptureOutputOnly captures only the model's output response, never the
+// system prompt or input messages, for completions made under the returned
+// context, overriding the meter and planner capture settings. Use it in
+// evaluation pipelines that score outputs but must not store inputs.
+func WithCaptureOutputOnly(ctx context.Context) context.Context {
+	return context.WithValue(ctx, captureOutputOnlyKey{}, true)
+}
+
+// captureOutputOnly reports whether WithCaptureOutputOnly is set on ctx.
+func captureOutputOnly(ctx context.Context) bool {
+	on, _ := ctx.Value(captureOutputOnlyKey{}).(bool)
+	return on
+}
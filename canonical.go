@@ -0,0 +1,30 @@
+package revenium
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// CanonicalJSON returns the canonical JSON encoding of a payload: object keys
+// at every level are sorted lexicographically and numbers are preserved
+// verbatim. Identical payloads always produce identical bytes, which makes the
+// output suitable for signing, hashing, and diffing exported captures.
+func CanonicalJSON(payload *MeteringPayload) ([]byte, error) {
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return nil, newMeteringError("failed to marshal payload", err)
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, newMeteringError("failed to decode payload", err)
+	}
+	// encoding/json emits map keys in sorted order, so re-encoding the generic
+	// representation yields sorted keys for struct fields and nested maps alike.
+	out, err := json.Marshal(v)
+	if err != nil {
+		return nil, newMeteringError("failed to marshal canonical payload", err)
+	}
+	return out, nil
+}
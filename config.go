@@ -1,16 +1,32 @@
 package revenium
 
 import (
+	"context"
+	"fmt"
+	"io"
 	"net/http"
+	"net/url"
 	"os"
+	"path"
 	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/metric"
 )
 
 const (
-	defaultBaseURL = "https://api.revenium.ai"
-	apiKeyPrefix   = "hak_"
+	defaultBaseURL      = "https://api.revenium.ai"
+	apiKeyPrefix        = "hak_"
+	defaultTenantHeader = "X-Revenium-Tenant"
 )
 
+// envTagVars maps static tag names to the environment variables WithEnvTags
+// reads them from.
+var envTagVars = map[string]string{
+	"hostname":  "HOSTNAME",
+	"namespace": "POD_NAMESPACE",
+}
+
 // Config holds the configuration for the Revenium metering middleware.
 type Config struct {
 	// APIKey is the Revenium API key (required, must start with "hak_").
@@ -19,10 +35,38 @@ type Config struct {
 	// BaseURL is the Revenium API base URL. Defaults to "https://api.revenium.ai".
 	BaseURL string
 
+	// Tenant routes requests on a multi-tenant Revenium deployment. It is
+	// sent in the TenantHeader request header.
+	Tenant string
+
+	// TenantHeader is the request header carrying Tenant. Defaults to
+	// "X-Revenium-Tenant".
+	TenantHeader string
+
+	// TenantIngressHost is the host of the multi-tenant Revenium ingress.
+	// NewMeter requires a Tenant when BaseURL points at this host.
+	TenantIngressHost string
+
 	// Squad is an optional override for the squad field. When empty, the squad
 	// is auto-detected from agent IDs.
 	Squad string
 
+	// SquadDelimiter separates the squad prefix from the agent name in agent
+	// IDs during squad auto-detection. Defaults to ".".
+	SquadDelimiter string
+
+	// SquadDepth is the number of leading agent ID segments that form the
+	// squad during auto-detection. Defaults to 1.
+	SquadDepth int
+
+	// SquadResolver, when set, is consulted before Squad and auto-detection.
+	// An empty result falls back to them.
+	SquadResolver func(ctx context.Context, agentID string) string
+
+	// MiddlewareSourcePrefix is an optional reseller identifier prepended to
+	// the middlewareSource field and the User-Agent header.
+	MiddlewareSourcePrefix string
+
 	// Environment identifies the deployment environment (e.g., "production", "staging").
 	Environment string
 
@@ -38,13 +82,270 @@ type Config struct {
 	// Subscriber holds subscriber metadata (ID, email, credential) for metering.
 	Subscriber *SubscriberResource
 
-	// Debug enables debug-level logging.
+	// AdditionalSubscribers are secondary subscribers sharing usage with
+	// Subscriber, for example in a pair-programming session.
+	AdditionalSubscribers []*SubscriberResource
+
+	// SubscriberSplit controls how usage is apportioned when there are
+	// additional subscribers. Defaults to SubscriberSplitPrimary.
+	SubscriberSplit string
+
+	// RunSessions reports the goa-ai run's session ID as the session of runs
+	// planned without WithSession. See WithRunSessions.
+	RunSessions bool
+
+	// Debug enables debug-level logging. It is a shortcut for LogLevel =
+	// LevelDebug and is ignored when WithLogLevel is used.
 	Debug bool
 
+	// LogLevel is the minimum severity logged by the meter. Defaults to LevelInfo.
+	LogLevel Level
+
+	// logLevelSet records that WithLogLevel was used, so Debug does not
+	// override it.
+	logLevelSet bool
+
+	// Transport, when set, replaces the HTTP delivery to the Revenium API.
+	Transport Transport
+
 	// HTTPClient is an optional custom HTTP client for sending metering requests.
 	HTTPClient *http.Client
+
+	// Proxy is an optional HTTP proxy URL for metering requests. It only
+	// applies when no custom HTTPClient is set.
+	Proxy string
+
+	// StaticTags are labels applied to every payload's tags beneath any tags
+	// already set on the payload.
+	StaticTags map[string]string
+
+	// EnvTags adds static tags from well-known environment variables (see
+	// WithEnvTags).
+	EnvTags bool
+
+	// FieldAllowlist, when non-empty, lists the optional payload fields (by
+	// JSON name) that may be sent; all others are cleared before marshaling.
+	FieldAllowlist []string
+
+	// SubscriberValidation checks subscriber emails and credential values
+	// before sending. See WithSubscriberValidation.
+	SubscriberValidation bool
+
+	// HostMetadata includes the hostname, process ID, and Go version in every
+	// payload. Disabled by default for privacy.
+	HostMetadata bool
+
+	// DefaultStopReason is the stop reason reported when the provider's reason
+	// is empty or unrecognized. Defaults to StopReasonEnd.
+	DefaultStopReason string
+
+	// StopReasonOverrides maps provider stop reasons to Revenium stop reasons,
+	// taking precedence over the built-in StopReasonMappings table.
+	StopReasonOverrides map[string]string
+
+	// ContextWindows maps model names to their maximum context size in
+	// tokens, enabling the contextUtilization payload field.
+	ContextWindows map[string]int
+
+	// TotalTokenSource selects how totalTokenCount is derived. Defaults to
+	// TotalTokensFromParts.
+	TotalTokenSource TotalTokenSource
+
+	// DisableCacheTokens omits provider-reported cache read/creation token
+	// counts from payloads.
+	DisableCacheTokens bool
+
+	// QuantityResolver computes the billedQuantity field for payloads whose
+	// billing unit is not BillingUnitPerToken.
+	QuantityResolver func(*MeteringPayload) float64
+
+	// CompletionStartMode selects which streamed chunk marks
+	// completionStartTime. Defaults to CompletionStartFirstVisibleToken.
+	CompletionStartMode CompletionStartMode
+
+	// CaptureScope selects which prompt fields are captured. When zero,
+	// MeteringPlanner.CapturePrompts decides (all fields or none).
+	CaptureScope CaptureScope
+
+	// InputTokenBreakdown adds an estimate of how input tokens split across
+	// message roles to each payload.
+	InputTokenBreakdown bool
+
+	// CapturePromptsFor restricts prompt capture to models matching one of
+	// these path.Match glob patterns. Empty keeps CapturePrompts/CaptureScope
+	// behavior for all models.
+	CapturePromptsFor []string
+
+	// IgnoredAgents lists path.Match glob patterns of agent IDs whose
+	// completions and stream events are passed through without metering.
+	IgnoredAgents []string
+
+	// CaptureRawUsage attaches the provider's raw usage object and stream
+	// metadata to each payload as JSON, for reconciling against invoices.
+	CaptureRawUsage bool
+
+	// SampleRate is the fraction of payloads sent, in [0, 1]. Zero sends
+	// none. Defaults to 1 (send everything) unless set with WithSampleRate.
+	SampleRate float64
+
+	// sampleRateSet records that WithSampleRate was used, so an explicit 0
+	// is not mistaken for the default.
+	sampleRateSet bool
+
+	// SampleRates overrides SampleRate for payloads whose resolved
+	// environment is listed. Values must be in [0, 1].
+	SampleRates map[string]float64
+
+	// AlwaysKeepTokens exempts payloads whose totalTokenCount is at least
+	// this value from sampling. Zero disables the threshold.
+	AlwaysKeepTokens int
+
+	// AlwaysKeep exempts payloads for which it returns true from sampling.
+	// Payloads with StopReasonError are always exempt.
+	AlwaysKeep func(*MeteringPayload) bool
+
+	// MaxBodyBytes caps the marshaled size of a payload. Zero disables the
+	// limit. OversizePolicy decides what happens to payloads above it.
+	MaxBodyBytes   int
+	OversizePolicy OversizePolicy
+
+	// DisableAmbiguousRetry stops retrying sends that failed after the request
+	// was fully written, which the server may already have processed.
+	DisableAmbiguousRetry bool
+
+	// RetryDecider, when set, decides whether and when to retry each failed
+	// send, replacing the built-in backoff and DisableAmbiguousRetry. See
+	// WithRetryDecider.
+	RetryDecider func(resp *http.Response, err error, attempt int) (retry bool, delay time.Duration)
+
+	// MaxConcurrency bounds concurrent sends with a pool of this many workers
+	// draining a queue. Zero starts a goroutine per payload.
+	MaxConcurrency int
+
+	// CancellableShutdown cancels in-flight sends when a FlushContext or
+	// Close context is done, instead of letting them run to their timeout.
+	CancellableShutdown bool
+
+	// StartupGrace is how long after NewMeter payloads that fail to connect
+	// are re-queued instead of dropped. Zero disables it.
+	StartupGrace time.Duration
+
+	// BreakerThreshold is the number of consecutive failed delivery attempts
+	// that opens the circuit breaker. Zero disables the breaker.
+	BreakerThreshold int
+
+	// BreakerCooldown is how long an open breaker rejects sends before
+	// letting a probe through.
+	BreakerCooldown time.Duration
+
+	// IDGenerator generates trace, transaction, and correlation IDs. Defaults
+	// to random UUIDs.
+	IDGenerator func() string
+
+	// CorrelationHeader is the name of a request header carrying a per-payload
+	// correlation ID (the transaction ID, or a generated one). Empty disables it.
+	CorrelationHeader string
+
+	// ResultBuffer enables Meter.Results with a channel of this capacity.
+	// Zero disables the result channel.
+	ResultBuffer int
+
+	// LatencyFastThreshold and LatencySlowThreshold classify RequestDuration
+	// into the latencyBucket payload field. Both must be set to enable it.
+	LatencyFastThreshold time.Duration
+	LatencySlowThreshold time.Duration
+
+	// DebugWriter receives a copy of every marshaled payload as one JSON
+	// object per line, in addition to the payload being sent.
+	DebugWriter io.Writer
+
+	// MeterProvider, when set, records OpenTelemetry metrics (completion
+	// count, token and latency histograms) for every metered completion.
+	MeterProvider metric.MeterProvider
+
+	// EventSink receives delivery lifecycle events. Nil disables events.
+	EventSink EventSink
+
+	// InlineMeteringSpan sends completion payloads synchronously inside an
+	// OpenTelemetry span before Complete (or the streamer's Close) returns.
+	InlineMeteringSpan bool
+
+	// PropagatedContextKeys lists context keys whose values are copied from
+	// the caller's context onto the detached context used for async sends.
+	PropagatedContextKeys []any
+
+	// SendContextFunc, when set, supplies the base context for async sends in
+	// place of context.Background(). It supersedes PropagatedContextKeys.
+	SendContextFunc func() context.Context
+
+	// VerifyOnStart makes NewMeter send a self-test payload and fail when it
+	// cannot be delivered.
+	VerifyOnStart bool
+
+	// ShadowBaseURL is an optional secondary Revenium API base URL. When set,
+	// every payload is mirrored to it on a best-effort basis.
+	ShadowBaseURL string
+
+	// ShadowAPIKey is the API key used for the shadow endpoint.
+	ShadowAPIKey string
 }
 
+// CaptureScope selects which prompt fields are captured in metering payloads.
+// Scopes can be combined with |.
+type CaptureScope uint8
+
+const (
+	// CaptureSystemOnly captures the system prompt.
+	CaptureSystemOnly CaptureScope = 1 << iota
+	// CaptureInputOnly captures the non-system input messages.
+	CaptureInputOnly
+	// CaptureOutputOnly captures the model's output response.
+	CaptureOutputOnly
+
+	// CaptureAll captures the system prompt, input messages, and output.
+	CaptureAll = CaptureSystemOnly | CaptureInputOnly | CaptureOutputOnly
+)
+
+// CompletionStartMode selects which streamed chunk sets completionStartTime,
+// i.e. how time to first token is defined for streaming completions.
+type CompletionStartMode int
+
+const (
+	// CompletionStartFirstVisibleToken uses the first text or tool call
+	// chunk, ignoring reasoning output. This is the default.
+	CompletionStartFirstVisibleToken CompletionStartMode = iota
+	// CompletionStartFirstChunk uses the first chunk of any kind.
+	CompletionStartFirstChunk
+	// CompletionStartFirstReasoningToken uses the first thinking chunk, or
+	// the first visible token when the model emits no reasoning.
+	CompletionStartFirstReasoningToken
+)
+
+// TotalTokenSource selects how the totalTokenCount payload field is derived.
+type TotalTokenSource int
+
+const (
+	// TotalTokensFromParts sums input and output tokens. This is the default.
+	TotalTokensFromParts TotalTokenSource = iota
+	// TotalTokensFromProvider uses the provider-reported total, for providers
+	// whose billed total differs from the sum of its parts. Completions
+	// without a provider total fall back to the sum.
+	TotalTokensFromProvider
+)
+
+// OversizePolicy selects how payloads larger than Config.MaxBodyBytes are
+// handled.
+type OversizePolicy int
+
+const (
+	// OversizeTruncate drops captured prompt content and raw usage from the
+	// payload and sets promptsTruncated, dropping the payload only if it is
+	// still too large. This is the default.
+	OversizeTruncate OversizePolicy = iota
+	// OversizeDrop drops the payload without sending it.
+	OversizeDrop
+)
+
 // Option is a functional option for configuring a Meter.
 type Option func(*Config)
 
@@ -58,11 +359,63 @@ func WithBaseURL(url string) Option {
 	return func(c *Config) { c.BaseURL = url }
 }
 
+// WithTenant sets the tenant sent in a routing header on every metering
+// request, for multi-tenant Revenium deployments that route by tenant rather
+// than by API key alone. Unlike the organization and subscriber fields, the
+// tenant is not part of the payload.
+func WithTenant(tenant string) Option {
+	return func(c *Config) { c.Tenant = tenant }
+}
+
+// WithTenantIngressHost sets the host of the multi-tenant Revenium ingress
+// (e.g., "ingress.revenium.example"). When BaseURL points at this host,
+// NewMeter fails unless a tenant is set (via WithTenant or REVENIUM_TENANT),
+// so requests are never sent to the ingress without a routing header.
+func WithTenantIngressHost(host string) Option {
+	return func(c *Config) { c.TenantIngressHost = host }
+}
+
+// WithTenantHeader sets the name of the tenant routing header. Configuring it
+// declares that the endpoint is a multi-tenant ingress, so NewMeter fails
+// unless a tenant is also set (via WithTenant or REVENIUM_TENANT).
+func WithTenantHeader(name string) Option {
+	return func(c *Config) { c.TenantHeader = name }
+}
+
 // WithSquad sets the squad name override.
 func WithSquad(squad string) Option {
 	return func(c *Config) { c.Squad = squad }
 }
 
+// WithSquadDelimiter sets the separator used to auto-detect the squad from
+// agent IDs (e.g., "/" for "billing/invoicer" or ":" for "billing:invoicer").
+func WithSquadDelimiter(delimiter string) Option {
+	return func(c *Config) { c.SquadDelimiter = delimiter }
+}
+
+// WithSquadDepth sets how many leading agent ID segments form the squad. With
+// depth 2, "org.team.agent" maps to squad "org.team".
+func WithSquadDepth(depth int) Option {
+	return func(c *Config) { c.SquadDepth = depth }
+}
+
+// WithSquadResolver derives the squad from the request context and agent ID,
+// e.g. from request metadata or a lookup table, for squad mappings not encoded
+// in agent IDs. It is consulted first; when it returns empty the static
+// override and auto-detection apply.
+func WithSquadResolver(resolver func(ctx context.Context, agentID string) string) Option {
+	return func(c *Config) { c.SquadResolver = resolver }
+}
+
+// WithMiddlewareSourcePrefix prepends a reseller identifier (e.g.,
+// "acme-platform/2.1") to the computed "goa-ai-revenium/<version>"
+// middlewareSource and User-Agent, so Revenium attributes traffic to the
+// embedding product while keeping the middleware version. The prefix must not
+// contain whitespace or header delimiters.
+func WithMiddlewareSourcePrefix(prefix string) Option {
+	return func(c *Config) { c.MiddlewareSourcePrefix = prefix }
+}
+
 // WithEnvironment sets the deployment environment.
 func WithEnvironment(env string) Option {
 	return func(c *Config) { c.Environment = env }
@@ -101,16 +454,452 @@ func WithSubscriberCredential(name, value string) Option {
 	}
 }
 
-// WithDebug enables debug-level logging.
+// WithAdditionalSubscriber adds a secondary subscriber that shares usage with
+// the primary subscriber. It can be repeated.
+func WithAdditionalSubscriber(id, email string) Option {
+	return func(c *Config) {
+		c.AdditionalSubscribers = append(c.AdditionalSubscribers, &SubscriberResource{ID: id, Email: email})
+	}
+}
+
+// WithSubscriberSplit sets how usage is apportioned across the primary and
+// additional subscribers (SubscriberSplitPrimary or SubscriberSplitEven).
+func WithSubscriberSplit(split string) Option {
+	return func(c *Config) { c.SubscriberSplit = split }
+}
+
+// WithRunSessions makes MeteringPlanner report the goa-ai runtime's session ID
+// (run.Context.SessionID) as the sessionId of payloads whose context has no
+// session set with WithSession. By default only WithSession sets it.
+func WithRunSessions(enabled bool) Option {
+	return func(c *Config) { c.RunSessions = enabled }
+}
+
+// WithDebug enables debug-level logging. An explicit WithLogLevel takes
+// precedence.
 func WithDebug(debug bool) Option {
 	return func(c *Config) { c.Debug = debug }
 }
 
+// WithProxy routes metering requests through the given HTTP proxy URL
+// (e.g., "http://proxy.internal:3128"). It is ignored when a custom client is
+// set with WithHTTPClient.
+func WithProxy(proxyURL string) Option {
+	return func(c *Config) { c.Proxy = proxyURL }
+}
+
+// WithLogLevel sets the minimum severity logged by the meter. Use LevelError
+// for error-only output or LevelSilent to suppress logging entirely.
+func WithLogLevel(level Level) Option {
+	return func(c *Config) {
+		c.LogLevel = level
+		c.logLevelSet = true
+	}
+}
+
+// WithTransport delivers payloads through transport instead of POSTing them to
+// the Revenium API, for deployments that publish metering to a message queue
+// and forward it from a collector. An API key is not required in this mode.
+// HTTP-specific options (WithHTTPClient, WithProxy, WithCorrelationHeader)
+// do not apply to the transport.
+func WithTransport(transport Transport) Option {
+	return func(c *Config) { c.Transport = transport }
+}
+
+// WithInMemorySink stores payloads in store instead of sending them, so the
+// full API works without network access for demos and examples. Any API key,
+// including a placeholder or none, is accepted in this mode. Inspect the
+// metered payloads with store.All after Flush.
+func WithInMemorySink(store *InMemoryStore) Option {
+	return func(c *Config) {
+		if store != nil {
+			c.Transport = store
+		}
+	}
+}
+
 // WithHTTPClient sets a custom HTTP client.
 func WithHTTPClient(client *http.Client) Option {
 	return func(c *Config) { c.HTTPClient = client }
 }
 
+// WithStaticTags adds process-wide labels (e.g., service, cluster) to the tags
+// of every payload. Tags set on a payload itself take precedence. It can be
+// repeated; later entries win.
+func WithStaticTags(tags map[string]string) Option {
+	return func(c *Config) {
+		if c.StaticTags == nil {
+			c.StaticTags = make(map[string]string, len(tags))
+		}
+		for k, v := range tags {
+			c.StaticTags[k] = v
+		}
+	}
+}
+
+// WithEnvTags adds static tags from well-known environment variables when
+// they are set: "hostname" from HOSTNAME and "namespace" from POD_NAMESPACE.
+// Tags given to WithStaticTags take precedence.
+func WithEnvTags(enabled bool) Option {
+	return func(c *Config) { c.EnvTags = enabled }
+}
+
+// WithFieldAllowlist restricts payloads to the given optional fields, named as
+// in the JSON payload (e.g., "traceId", "environment"). Every other optional
+// field, including subscriber details and captured prompts, is cleared as the
+// last step before marshaling, whatever other options set it. Required fields
+// (model, token counts, timestamps, and so on) are always sent. It can be
+// repeated.
+func WithFieldAllowlist(fields []string) Option {
+	return func(c *Config) { c.FieldAllowlist = append(c.FieldAllowlist, fields...) }
+}
+
+// WithSubscriberValidation checks subscribers before each payload is sent: a
+// malformed email is logged as a warning, and a credential value that looks
+// like a secret (a known API key prefix or a long, high-entropy string) is
+// logged and removed from the payload, keeping the credential name. Send a
+// hash or a name as the credential value instead of the secret itself. Log
+// messages identify the subscriber by a short SHA-256 prefix of its ID and
+// email rather than the values themselves.
+func WithSubscriberValidation(enabled bool) Option {
+	return func(c *Config) { c.SubscriberValidation = enabled }
+}
+
+// WithHostMetadata includes the emitting host's hostname, process ID, and Go
+// version in every payload, to trace usage back to a specific pod or process.
+func WithHostMetadata(enabled bool) Option {
+	return func(c *Config) { c.HostMetadata = enabled }
+}
+
+// WithDefaultStopReason sets the stop reason reported when the provider's
+// reason is empty or unrecognized (e.g., StopReasonError to make ambiguous
+// completions stand out). It must be one of the StopReason constants.
+func WithDefaultStopReason(reason string) Option {
+	return func(c *Config) { c.DefaultStopReason = reason }
+}
+
+// WithStopReasonMapping maps a provider stop reason to a Revenium stop reason
+// for this meter, overriding or extending StopReasonMappings. The target must
+// be one of the StopReason constants.
+func WithStopReasonMapping(providerReason, reveniumReason string) Option {
+	return func(c *Config) {
+		if c.StopReasonOverrides == nil {
+			c.StopReasonOverrides = make(map[string]string)
+		}
+		c.StopReasonOverrides[providerReason] = reveniumReason
+	}
+}
+
+// WithContextWindows sets the maximum context size, in tokens, of each model.
+// Payloads for these models get a contextUtilization field (input tokens
+// divided by the window) to flag agents close to overflowing their context.
+// It can be repeated; later entries win.
+func WithContextWindows(windows map[string]int) Option {
+	return func(c *Config) {
+		if c.ContextWindows == nil {
+			c.ContextWindows = make(map[string]int, len(windows))
+		}
+		for model, size := range windows {
+			c.ContextWindows[model] = size
+		}
+	}
+}
+
+// WithTotalTokenSource sets how totalTokenCount is derived: summed from input
+// and output tokens (the default) or taken from the provider's own total.
+func WithTotalTokenSource(source TotalTokenSource) Option {
+	return func(c *Config) { c.TotalTokenSource = source }
+}
+
+// WithCacheTokens controls whether provider-reported cache read and creation
+// token counts are included in payloads. Enabled by default; disable it to work
+// around providers that report bogus cache counts.
+func WithCacheTokens(enabled bool) Option {
+	return func(c *Config) { c.DisableCacheTokens = !enabled }
+}
+
+// WithQuantityResolver sets the function that computes billedQuantity for
+// payloads not billed per token (e.g., a request count or characters / 1000),
+// so Revenium bills on the right basis. Token counts are still reported for
+// analytics.
+func WithQuantityResolver(resolver func(*MeteringPayload) float64) Option {
+	return func(c *Config) { c.QuantityResolver = resolver }
+}
+
+// WithCompletionStartMode sets which streamed chunk marks the completion start
+// time, so time to first token matches how a product defines it for
+// reasoning models. Streams without a matching chunk report the request time.
+func WithCompletionStartMode(mode CompletionStartMode) Option {
+	return func(c *Config) { c.CompletionStartMode = mode }
+}
+
+// WithCaptureScope enables prompt capture limited to the given fields, e.g.
+// CaptureSystemOnly to keep the system prompt but never user content. It takes
+// precedence over MeteringPlanner.CapturePrompts for every planner using this
+// meter.
+func WithCaptureScope(scope CaptureScope) Option {
+	return func(c *Config) { c.CaptureScope = scope }
+}
+
+// WithCapturePromptsFor enables prompt capture only for models matching one of
+// the glob patterns (path.Match syntax, e.g. "gpt-4o*"), regardless of the
+// planner's CapturePrompts flag; all other models are never captured. The
+// fields captured follow WithCaptureScope, or all of them when unset. It can
+// be repeated.
+func WithCapturePromptsFor(models []string) Option {
+	return func(c *Config) { c.CapturePromptsFor = append(c.CapturePromptsFor, models...) }
+}
+
+// WithIgnoredAgents passes completions and stream events from agents matching
+// one of the glob patterns (path.Match syntax, e.g. "orchestrator.*") through
+// without metering. Use it for orchestrator agents that make no billable LLM
+// calls. The patterns match MeteringPlanner.AgentID; the sink skips events of
+// runs planned by an ignored agent and of child runs linked to one. Trace
+// correlation is kept, so child runs of an ignored agent still join its
+// trace. It can be repeated.
+func WithIgnoredAgents(agents []string) Option {
+	return func(c *Config) { c.IgnoredAgents = append(c.IgnoredAgents, agents...) }
+}
+
+// WithInputTokenBreakdown records an inputTokenBreakdown field estimating how
+// many input tokens came from system, user, assistant, and tool messages.
+// goa-ai providers report only a total, so the count is apportioned in
+// proportion to each role's character count in the request. Disabled by default.
+func WithInputTokenBreakdown(enabled bool) Option {
+	return func(c *Config) { c.InputTokenBreakdown = enabled }
+}
+
+// WithCaptureRawUsage attaches the provider-reported usage object (and, for
+// streams, provider metadata) to each payload as a rawUsage JSON field. Unlike
+// prompt capture this records metadata only, never content.
+func WithCaptureRawUsage(enabled bool) Option {
+	return func(c *Config) { c.CaptureRawUsage = enabled }
+}
+
+// WithSampleRate sends only the given fraction of payloads, chosen at random,
+// to save metering quota. rate must be in [0, 1]: 1, the default, sends all of
+// them and 0 sends none, as in WithSampleRates. Sampled-out payloads are
+// counted in Stats().SampledOut.
+func WithSampleRate(rate float64) Option {
+	return func(c *Config) {
+		c.SampleRate = rate
+		c.sampleRateSet = true
+	}
+}
+
+// WithAlwaysKeepTokens sends every payload with at least tokens total tokens,
+// bypassing WithSampleRate and WithSampleRates, so expensive calls are never
+// sampled out.
+func WithAlwaysKeepTokens(tokens int) Option {
+	return func(c *Config) { c.AlwaysKeepTokens = tokens }
+}
+
+// WithAlwaysKeep sends every payload for which keep returns true, bypassing
+// WithSampleRate and WithSampleRates. Use it for rules such as an estimated
+// cost threshold. keep runs on the caller's goroutine after enrichment and
+// must be fast. Failed completions (StopReasonError) are always kept.
+func WithAlwaysKeep(keep func(*MeteringPayload) bool) Option {
+	return func(c *Config) { c.AlwaysKeep = keep }
+}
+
+// WithSampleRates overrides the sample rate per environment, keyed by the
+// payload's resolved environment (see WithEnvironment and
+// WithEnvironmentName). Environments not listed use WithSampleRate. It can be
+// repeated; later entries win.
+func WithSampleRates(rates map[string]float64) Option {
+	return func(c *Config) {
+		if c.SampleRates == nil {
+			c.SampleRates = make(map[string]float64, len(rates))
+		}
+		for env, rate := range rates {
+			c.SampleRates[env] = rate
+		}
+	}
+}
+
+// WithMaxBodyBytes caps the marshaled size of each payload at n bytes, so a
+// pathological captured prompt cannot waste bandwidth on a request the API
+// would reject. Oversized payloads are handled per WithOversizePolicy.
+func WithMaxBodyBytes(n int) Option {
+	return func(c *Config) { c.MaxBodyBytes = n }
+}
+
+// WithOversizePolicy sets how payloads above WithMaxBodyBytes are handled.
+// Defaults to OversizeTruncate.
+func WithOversizePolicy(policy OversizePolicy) Option {
+	return func(c *Config) { c.OversizePolicy = policy }
+}
+
+// WithRetryOnAmbiguous controls whether sends that fail after the request was
+// fully written but before a response arrived (e.g., a timeout while the
+// server was processing) are retried. Such a payload may already be recorded,
+// so retrying risks double-billing; pass false for billing-sensitive
+// deployments. Defaults to true for compatibility, logging a warning on each
+// such retry.
+func WithRetryOnAmbiguous(enabled bool) Option {
+	return func(c *Config) { c.DisableAmbiguousRetry = !enabled }
+}
+
+// WithRetryDecider hands retry decisions to decide, for infrastructure whose
+// proxies or backends need unusual retry rules. After each failed attempt,
+// decide is called with the response (nil when none was received, e.g. on a
+// network error or with a custom Transport), the error, and the 1-based number
+// of the failed attempt. It returns whether to retry and how long to wait
+// first. It replaces the built-in exponential backoff and WithRetryOnAmbiguous,
+// but not the limit of three retries, and delays shorter than one second are
+// raised to one second so a decider cannot retry in a tight loop. Sends remain
+// bounded by their 30-second timeout and by WithCircuitBreaker.
+func WithRetryDecider(decide func(resp *http.Response, err error, attempt int) (retry bool, delay time.Duration)) Option {
+	return func(c *Config) { c.RetryDecider = decide }
+}
+
+// WithMaxConcurrency delivers payloads, including shadow sends, with a fixed
+// pool of n workers instead of a goroutine per send, bounding concurrent
+// sends and their HTTP connections during bursts. SendAsync enqueues without
+// blocking; when the queue (64 sends per worker) is full the payload is
+// dropped and counted in Stats().QueueDropped. Flush waits for queued
+// payloads too. The workers run until Close, so a meter using this option
+// must be closed with Close rather than only flushed.
+func WithMaxConcurrency(n int) Option {
+	return func(c *Config) { c.MaxConcurrency = n }
+}
+
+// WithCancellableShutdown makes FlushContext and Close abort in-flight sends,
+// including their HTTP requests and inline sends made with
+// WithInlineMeteringSpan, when their context is canceled or times out.
+// By default those sends are detached and keep running to their own timeout
+// after the caller gives up. Payloads aborted this way are lost.
+func WithCancellableShutdown(enabled bool) Option {
+	return func(c *Config) { c.CancellableShutdown = enabled }
+}
+
+// WithStartupGrace re-queues payloads that fail with DNS or connection errors
+// during the first d after NewMeter, instead of dropping them once their
+// retries are exhausted. It salvages metering emitted while a container's
+// network is still coming up; after the window normal drop behavior applies.
+// Re-queued sends hold Flush until they resolve.
+func WithStartupGrace(d time.Duration) Option {
+	return func(c *Config) { c.StartupGrace = d }
+}
+
+// WithCircuitBreaker stops delivery attempts after failureThreshold consecutive
+// failures, so an outage does not pile up retrying goroutines. While open,
+// sends are dropped, logged at debug level rather than as errors, and counted
+// in Stats().BreakerRejected and Stats().Failed. After cooldown a single probe
+// is let through: success closes the breaker, failure reopens it.
+func WithCircuitBreaker(failureThreshold int, cooldown time.Duration) Option {
+	return func(c *Config) {
+		c.BreakerThreshold = failureThreshold
+		c.BreakerCooldown = cooldown
+	}
+}
+
+// WithIDGenerator sets the function used for the IDs the meter generates:
+// trace IDs for top-level runs, self-test transaction IDs, and correlation IDs.
+// IDs should be unique; an empty result falls back to a random UUID.
+// WithTraceContext, which has no meter, always uses a random UUID.
+func WithIDGenerator(generate func() string) Option {
+	return func(c *Config) { c.IDGenerator = generate }
+}
+
+// WithCorrelationHeader sends a correlation ID in the named header (e.g.,
+// "X-Correlation-Id") on every metering request, including retries. The ID is
+// the payload's transaction ID, or a generated one when that is empty, so
+// client logs can be joined with Revenium's server logs.
+func WithCorrelationHeader(name string) Option {
+	return func(c *Config) { c.CorrelationHeader = name }
+}
+
+// WithResultChannel publishes a SendResult for every completed send on
+// Meter.Results, using a channel with the given buffer size. Results are
+// dropped rather than blocking delivery when the buffer is full.
+func WithResultChannel(buffer int) Option {
+	return func(c *Config) { c.ResultBuffer = buffer }
+}
+
+// WithLatencyBuckets adds a coarse latencyBucket field to every payload:
+// "fast" when the request took less than fast, "slow" when it took slow or
+// longer, and "normal" otherwise.
+func WithLatencyBuckets(fast, slow time.Duration) Option {
+	return func(c *Config) {
+		c.LatencyFastThreshold = fast
+		c.LatencySlowThreshold = slow
+	}
+}
+
+// WithDebugWriter writes the exact JSON body of every payload to w, one
+// object per line, in addition to sending it. Writes are serialized, so w does
+// not need to be safe for concurrent use.
+func WithDebugWriter(w io.Writer) Option {
+	return func(c *Config) { c.DebugWriter = w }
+}
+
+// WithMeterProvider records OpenTelemetry metrics for every metered completion:
+// a revenium.completions counter plus revenium.completion.tokens and
+// revenium.completion.duration histograms, tagged by model, provider, and
+// environment.
+func WithMeterProvider(provider metric.MeterProvider) Option {
+	return func(c *Config) { c.MeterProvider = provider }
+}
+
+// WithEventSink registers a sink that receives every delivery lifecycle event
+// (payload built, send started, retried, succeeded, failed, dropped).
+func WithEventSink(sink EventSink) Option {
+	return func(c *Config) { c.EventSink = sink }
+}
+
+// WithInlineMeteringSpan sends each completion's payload synchronously, inside
+// a "revenium.metering.send" child span of the completion's context, before
+// Complete or the streamer's Close returns. The span comes from the global
+// OpenTelemetry tracer provider, so metering latency is attributed to the
+// right trace.
+//
+// The tradeoff is latency: the model call does not return until metering is
+// delivered or has exhausted its retries (bounded by the send timeout). The
+// default asynchronous delivery is recommended unless precise tracing matters
+// more than completion latency.
+func WithInlineMeteringSpan(enabled bool) Option {
+	return func(c *Config) { c.InlineMeteringSpan = enabled }
+}
+
+// WithContextValuePropagation copies the values stored under keys from the
+// caller's context onto the detached context used for async sends, so a custom
+// HTTP transport can still see request IDs or tracing baggage. Cancellation
+// and deadlines of the caller's context are never propagated.
+func WithContextValuePropagation(keys ...any) Option {
+	return func(c *Config) {
+		c.PropagatedContextKeys = append(c.PropagatedContextKeys, keys...)
+	}
+}
+
+// WithSendContextFunc sets a function that SendAsync calls to obtain the base
+// context for each send, instead of a detached context.Background(). The send
+// timeout is still applied on top of it. It is an escape hatch for injecting
+// auth, tracing, or deadlines, and supersedes WithContextValuePropagation.
+//
+// The returned context must outlive the send: if it can be canceled, the
+// caller is responsible for not canceling it while metering is in flight.
+func WithSendContextFunc(fn func() context.Context) Option {
+	return func(c *Config) { c.SendContextFunc = fn }
+}
+
+// WithVerifyOnStart makes NewMeter run Meter.SelfTest (bounded by a short
+// timeout) and return an error if Revenium cannot be reached, for deployments
+// where billing must not silently degrade. Disabled by default.
+func WithVerifyOnStart(enabled bool) Option {
+	return func(c *Config) { c.VerifyOnStart = enabled }
+}
+
+// WithShadowEndpoint mirrors every payload to a second Revenium API, e.g. to
+// validate ingestion parity during a migration. Shadow sends are attempted
+// once; failures are logged and never affect the primary send.
+func WithShadowEndpoint(baseURL, apiKey string) Option {
+	return func(c *Config) {
+		c.ShadowBaseURL = baseURL
+		c.ShadowAPIKey = apiKey
+	}
+}
+
 func loadFromEnv(c *Config) {
 	if v := os.Getenv("REVENIUM_API_KEY"); v != "" && c.APIKey == "" {
 		c.APIKey = v
@@ -136,6 +925,27 @@ func loadFromEnv(c *Config) {
 	if v := os.Getenv("REVENIUM_PRODUCT_NAME"); v != "" && c.ProductName == "" {
 		c.ProductName = v
 	}
+	if v := os.Getenv("REVENIUM_TENANT"); v != "" && c.Tenant == "" {
+		c.Tenant = v
+	}
+	if v := os.Getenv("REVENIUM_TENANT_INGRESS_HOST"); v != "" && c.TenantIngressHost == "" {
+		c.TenantIngressHost = v
+	}
+	if v := os.Getenv("REVENIUM_PROXY"); v != "" && c.Proxy == "" {
+		c.Proxy = v
+	}
+	if c.EnvTags {
+		for tag, env := range envTagVars {
+			if v := os.Getenv(env); v != "" {
+				if _, ok := c.StaticTags[tag]; !ok {
+					if c.StaticTags == nil {
+						c.StaticTags = make(map[string]string)
+					}
+					c.StaticTags[tag] = v
+				}
+			}
+		}
+	}
 	if c.Subscriber == nil {
 		subID := os.Getenv("REVENIUM_SUBSCRIBER_ID")
 		subEmail := os.Getenv("REVENIUM_SUBSCRIBER_EMAIL")
@@ -146,12 +956,86 @@ func loadFromEnv(c *Config) {
 }
 
 func (c *Config) validate() error {
-	if c.APIKey == "" {
+	if c.APIKey == "" && c.Transport == nil {
 		return newConfigError("API key is required", nil)
 	}
-	if !strings.HasPrefix(c.APIKey, apiKeyPrefix) {
+	if _, inMemory := c.Transport.(*InMemoryStore); c.APIKey != "" && !inMemory && !strings.HasPrefix(c.APIKey, apiKeyPrefix) {
 		return newConfigError("API key must start with \"hak_\"", nil)
 	}
+	if c.TenantHeader != "" && c.Tenant == "" {
+		return newConfigError(fmt.Sprintf("tenant header %q is configured but no tenant is set", c.TenantHeader), nil)
+	}
+	if c.TenantIngressHost != "" && c.Tenant == "" && isTenantIngress(c.BaseURL, c.TenantIngressHost) {
+		return newConfigError(fmt.Sprintf("base URL %q is the multi-tenant ingress but no tenant is set", c.BaseURL), nil)
+	}
+	if strings.ContainsAny(c.Tenant, "\r\n") {
+		return newConfigError("tenant must not contain line breaks", nil)
+	}
+	if c.MiddlewareSourcePrefix != "" && !validSourcePrefix(c.MiddlewareSourcePrefix) {
+		return newConfigError(fmt.Sprintf("invalid middleware source prefix %q", c.MiddlewareSourcePrefix), nil)
+	}
+	if c.Proxy != "" {
+		if u, err := url.Parse(c.Proxy); err != nil || u.Scheme == "" || u.Host == "" {
+			return newConfigError(fmt.Sprintf("invalid proxy URL %q", c.Proxy), err)
+		}
+	}
+	for _, pattern := range c.CapturePromptsFor {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return newConfigError(fmt.Sprintf("invalid capture model pattern %q", pattern), err)
+		}
+	}
+	for _, pattern := range c.IgnoredAgents {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return newConfigError(fmt.Sprintf("invalid ignored agent pattern %q", pattern), err)
+		}
+	}
+	for _, name := range c.FieldAllowlist {
+		if _, ok := payloadFields[name]; !ok {
+			return newConfigError(fmt.Sprintf("unknown payload field %q in allowlist", name), nil)
+		}
+	}
+	if c.LatencyFastThreshold > c.LatencySlowThreshold {
+		return newConfigError("fast latency threshold must not exceed slow threshold", nil)
+	}
+	if c.DefaultStopReason != "" && !isValidStopReason(c.DefaultStopReason) {
+		return newConfigError(fmt.Sprintf("invalid default stop reason %q", c.DefaultStopReason), nil)
+	}
+	for provider, reason := range c.StopReasonOverrides {
+		if !isValidStopReason(reason) {
+			return newConfigError(fmt.Sprintf("invalid stop reason %q mapped from %q", reason, provider), nil)
+		}
+	}
+	for model, size := range c.ContextWindows {
+		if size <= 0 {
+			return newConfigError(fmt.Sprintf("invalid context window %d for model %q", size, model), nil)
+		}
+	}
+	if c.SampleRate < 0 || c.SampleRate > 1 {
+		return newConfigError(fmt.Sprintf("sample rate %v must be in [0, 1]", c.SampleRate), nil)
+	}
+	for env, rate := range c.SampleRates {
+		if rate < 0 || rate > 1 {
+			return newConfigError(fmt.Sprintf("sample rate %v for environment %q must be in [0, 1]", rate, env), nil)
+		}
+	}
+	if c.MaxConcurrency < 0 {
+		return newConfigError(fmt.Sprintf("max concurrency %d must not be negative", c.MaxConcurrency), nil)
+	}
+	if c.AlwaysKeepTokens < 0 {
+		return newConfigError(fmt.Sprintf("always-keep token threshold %d must not be negative", c.AlwaysKeepTokens), nil)
+	}
+	if c.BreakerThreshold < 0 || (c.BreakerThreshold > 0 && c.BreakerCooldown <= 0) {
+		return newConfigError("circuit breaker requires a positive threshold and cooldown", nil)
+	}
+	if c.MaxBodyBytes < 0 {
+		return newConfigError("max body bytes must not be negative", nil)
+	}
+	if c.SubscriberSplit != "" && !isValidSubscriberSplit(c.SubscriberSplit) {
+		return newConfigError(fmt.Sprintf("invalid subscriber split %q", c.SubscriberSplit), nil)
+	}
+	if c.ShadowBaseURL != "" && !strings.HasPrefix(c.ShadowAPIKey, apiKeyPrefix) {
+		return newConfigError("shadow API key must start with \"hak_\"", nil)
+	}
 	return nil
 }
 
@@ -159,7 +1043,34 @@ func (c *Config) applyDefaults() {
 	if c.BaseURL == "" {
 		c.BaseURL = defaultBaseURL
 	}
+	if !c.sampleRateSet {
+		c.SampleRate = 1
+	}
+	if c.HTTPClient == nil && c.Proxy != "" {
+		if proxyURL, err := url.Parse(c.Proxy); err == nil {
+			transport := http.DefaultTransport.(*http.Transport).Clone()
+			transport.Proxy = http.ProxyURL(proxyURL)
+			c.HTTPClient = &http.Client{Transport: transport}
+		}
+	}
 	if c.HTTPClient == nil {
+		// http.DefaultClient already honors HTTPS_PROXY, HTTP_PROXY and NO_PROXY.
 		c.HTTPClient = http.DefaultClient
 	}
+	if c.Tenant != "" && c.TenantHeader == "" {
+		c.TenantHeader = defaultTenantHeader
+	}
+	if c.Debug && !c.logLevelSet {
+		c.LogLevel = LevelDebug
+	}
+}
+
+// isTenantIngress reports whether baseURL points at ingressHost. The host is
+// compared case-insensitively and ignoring any port.
+func isTenantIngress(baseURL, ingressHost string) bool {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(u.Hostname(), ingressHost)
 }
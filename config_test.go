@@ -0,0 +1,68 @@
+package revenium
+
+import "testing"
+
+func TestTenantIngressValidation(t *testing.T) {
+	const ingress = "ingress.revenium.example"
+	tests := []struct {
+		name    string
+		opts    []Option
+		wantErr bool
+	}{
+		{"ingress without tenant", []Option{WithBaseURL("https://ingress.revenium.example"), WithTenantIngressHost(ingress)}, true},
+		{"ingress with port and case", []Option{WithBaseURL("https://Ingress.Revenium.Example:8443/v2"), WithTenantIngressHost(ingress)}, true},
+		{"ingress with tenant", []Option{WithBaseURL("https://ingress.revenium.example"), WithTenantIngressHost(ingress), WithTenant("acme")}, false},
+		{"other host without tenant", []Option{WithBaseURL("https://api.revenium.ai"), WithTenantIngressHost(ingress)}, false},
+		{"no ingress configured", []Option{WithBaseURL("https://ingress.revenium.example")}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("REVENIUM_TENANT", "")
+			t.Setenv("REVENIUM_TENANT_INGRESS_HOST", "")
+			m, err := NewMeter(append([]Option{WithAPIKey("hak_test")}, tt.opts...)...)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewMeter error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if m != nil {
+				_ = m.Close(t.Context())
+			}
+		})
+	}
+}
+
+func TestSampleRateValidation(t *testing.T) {
+	for _, rate := range []float64{0, 0.5, 1} {
+		m, err := NewMeter(WithTransport(NewInMemoryStore()), WithSampleRate(rate))
+		if err != nil {
+			t.Errorf("WithSampleRate(%v): %v", rate, err)
+			continue
+		}
+		_ = m.Close(t.Context())
+	}
+	for _, rate := range []float64{-0.1, 1.5} {
+		if _, err := NewMeter(WithTransport(NewInMemoryStore()), WithSampleRate(rate)); err == nil {
+			t.Errorf("WithSampleRate(%v) succeeded, want an error", rate)
+		}
+	}
+}
+
+func TestDebugDoesNotOverrideLogLevel(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []Option
+		want Level
+	}{
+		{"default", nil, LevelInfo},
+		{"debug", []Option{WithDebug(true)}, LevelDebug},
+		{"explicit level wins", []Option{WithDebug(true), WithLogLevel(LevelError)}, LevelError},
+		{"explicit level wins in any order", []Option{WithLogLevel(LevelInfo), WithDebug(true)}, LevelInfo},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, _ := newTestMeter(t, tt.opts...)
+			if m.cfg.LogLevel != tt.want || m.logger.level != tt.want {
+				t.Errorf("log level = %v (logger %v), want %v", m.cfg.LogLevel, m.logger.level, tt.want)
+			}
+		})
+	}
+}
@@ -1,10 +1,6 @@
 package revenium
 
-import (
-	"context"
-
-	"github.com/google/uuid"
-)
+import "context"
 
 type contextKey struct{}
 
@@ -27,10 +23,29 @@ type TraceContext struct {
 
 	// Squad is the agent group identifier.
 	Squad string
+
+	// PlanPhase records which planner lifecycle call is active
+	// (PlanPhaseStart or PlanPhaseResume).
+	PlanPhase string
+
+	// Step names the capability that started the run: the fully-qualified
+	// tool identifier when the agent runs as a tool of another agent, or
+	// empty for top-level runs.
+	Step string
 }
 
+// Planner phases recorded on TraceContext.PlanPhase and metering payloads.
+const (
+	PlanPhaseStart  = "start"
+	PlanPhaseResume = "resume"
+)
+
 // WithTraceContext stores a TraceContext in the context.
 // A shallow copy is made to avoid mutating the input struct.
+//
+// MeteringPlanner honors a TraceContext found on the context passed to
+// PlanStart, so callers can seed it with an upstream correlation ID to use as
+// the Revenium trace instead of a generated one.
 func WithTraceContext(ctx context.Context, tc *TraceContext) context.Context {
 	if tc == nil {
 		tc = &TraceContext{}
@@ -38,13 +53,52 @@ func WithTraceContext(ctx context.Context, tc *TraceContext) context.Context {
 	// Create a shallow copy to avoid mutating the caller's struct
 	tcCopy := *tc
 	if tcCopy.TraceID == "" {
-		tcCopy.TraceID = uuid.New().String()
+		tcCopy.TraceID = newUUID()
 	}
 	return context.WithValue(ctx, contextKey{}, &tcCopy)
 }
 
+// rootTraceKey is the context key for the WithRootTrace flag.
+type rootTraceKey struct{}
+
+// WithRootTrace marks runs planned under the returned context as top-level:
+// MeteringPlanner starts a new trace with no parent transaction, regardless of
+// the runtime's ParentRunID or a TraceContext inherited from the caller. Use it
+// for logically independent runs that would otherwise be linked to the run
+// that spawned them.
+//
+// The flag takes precedence over the child trace mapping MeteringSink
+// pre-registers on ChildRunLinked: PlanStart replaces it with the new trace,
+// and PlanResume of the same run keeps that trace.
+func WithRootTrace(ctx context.Context) context.Context {
+	return context.WithValue(ctx, rootTraceKey{}, true)
+}
+
+// isRootTrace reports whether ctx was marked with WithRootTrace.
+func isRootTrace(ctx context.Context) bool {
+	root, _ := ctx.Value(rootTraceKey{}).(bool)
+	return root
+}
+
 // GetTraceContext retrieves the TraceContext from the context, or nil if not set.
 func GetTraceContext(ctx context.Context) *TraceContext {
 	tc, _ := ctx.Value(contextKey{}).(*TraceContext)
 	return tc
 }
+
+// traceContext returns the TraceContext from ctx like GetTraceContext, but logs
+// a warning, once per meter, when the context key holds a value of an
+// unexpected type instead of silently treating it as unset.
+func (m *Meter) traceContext(ctx context.Context) *TraceContext {
+	v := ctx.Value(contextKey{})
+	if v == nil {
+		return nil
+	}
+	tc, ok := v.(*TraceContext)
+	if !ok {
+		m.badTraceCtx.Do(func() {
+			m.logger.Warn("ignoring trace context value of unexpected type %T", v)
+		})
+	}
+	return tc
+}
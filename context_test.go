@@ -0,0 +1,47 @@
+package revenium
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"strings"
+	"testing"
+)
+
+// captureLog redirects the standard logger to a buffer for the test.
+func captureLog(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	prev, flags := log.Writer(), log.Flags()
+	log.SetOutput(&buf)
+	log.SetFlags(0)
+	t.Cleanup(func() {
+		log.SetOutput(prev)
+		log.SetFlags(flags)
+	})
+	return &buf
+}
+
+func TestWrongTypedContextValues(t *testing.T) {
+	m, _ := newTestMeter(t)
+	buf := captureLog(t)
+	ctx := context.WithValue(context.Background(), contextKey{}, "not a trace context")
+	ctx = context.WithValue(ctx, meteringContextKey{}, TraceContext{})
+
+	for range 3 {
+		if tc := m.traceContext(ctx); tc != nil {
+			t.Fatalf("traceContext = %+v, want nil", tc)
+		}
+		if mc := m.meteringContext(ctx); mc != nil {
+			t.Fatalf("meteringContext = %+v, want nil", mc)
+		}
+	}
+
+	out := buf.String()
+	if got := strings.Count(out, "ignoring trace context value of unexpected type string"); got != 1 {
+		t.Errorf("trace context warning logged %d times, want 1:\n%s", got, out)
+	}
+	if got := strings.Count(out, "ignoring metering context value of unexpected type revenium.TraceContext"); got != 1 {
+		t.Errorf("metering context warning logged %d times, want 1:\n%s", got, out)
+	}
+}
@@ -45,3 +45,7 @@ func newMeteringError(msg string, err error) *ReveniumError {
 func newNetworkError(msg string, err error) *ReveniumError {
 	return &ReveniumError{Type: ErrorTypeNetwork, Message: msg, Err: err}
 }
+
+func newValidationError(msg string, err error) *ReveniumError {
+	return &ReveniumError{Type: ErrorTypeValidation, Message: msg, Err: err}
+}
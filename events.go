@@ -0,0 +1,48 @@
+package revenium
+
+import "time"
+
+// EventSink receives lifecycle events from a Meter's delivery pipeline. It is
+// a single hook for building observability adapters; the result channel,
+// debug writer, and OpenTelemetry instruments can all be expressed on top of
+// it.
+//
+// Methods are called synchronously from the goroutine delivering the payload
+// and must not block. Payloads must be treated as read-only. Embed
+// NopEventSink to implement only the events of interest.
+type EventSink interface {
+	// PayloadBuilt is called once a payload has been enriched and queued.
+	PayloadBuilt(payload *MeteringPayload)
+
+	// SendStarted is called before the first delivery attempt.
+	SendStarted(payload *MeteringPayload)
+
+	// SendRetried is called before each retry, with the 1-based retry number
+	// and the error from the previous attempt.
+	SendRetried(payload *MeteringPayload, attempt int, err error)
+
+	// SendSucceeded is called when the Revenium API accepts the payload.
+	SendSucceeded(payload *MeteringPayload, retries int, latency time.Duration)
+
+	// SendFailed is called when the payload could not be delivered, including
+	// after PayloadDropped.
+	SendFailed(payload *MeteringPayload, retries int, err error)
+
+	// PayloadDropped is called when a payload is discarded without being
+	// sent, e.g. because it failed validation or exceeded WithMaxBodyBytes.
+	PayloadDropped(payload *MeteringPayload, err error)
+}
+
+// NopEventSink is an EventSink that ignores all events. Embed it in a custom
+// sink to implement only some of the methods.
+type NopEventSink struct{}
+
+func (NopEventSink) PayloadBuilt(*MeteringPayload)                      {}
+func (NopEventSink) SendStarted(*MeteringPayload)                       {}
+func (NopEventSink) SendRetried(*MeteringPayload, int, error)           {}
+func (NopEventSink) SendSucceeded(*MeteringPayload, int, time.Duration) {}
+func (NopEventSink) SendFailed(*MeteringPayload, int, error)            {}
+func (NopEventSink) PayloadDropped(*MeteringPayload, error)             {}
+
+// Compile-time interface satisfaction check.
+var _ EventSink = NopEventSink{}
@@ -0,0 +1,37 @@
+package revenium
+
+import (
+	"reflect"
+	"strings"
+)
+
+// payloadField describes a MeteringPayload field by its JSON name.
+type payloadField struct {
+	index    int
+	required bool // no omitempty: always sent
+}
+
+// payloadFields indexes MeteringPayload fields by JSON name.
+var payloadFields = func() map[string]payloadField {
+	t := reflect.TypeFor[MeteringPayload]()
+	fields := make(map[string]payloadField, t.NumField())
+	for i := range t.NumField() {
+		name, opts, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		fields[name] = payloadField{index: i, required: !strings.Contains(opts, "omitempty")}
+	}
+	return fields
+}()
+
+// applyFieldAllowlist zeroes every optional payload field whose JSON name is
+// not in allow. Required fields are always kept.
+func applyFieldAllowlist(payload *MeteringPayload, allow map[string]bool) {
+	v := reflect.ValueOf(payload).Elem()
+	for name, f := range payloadFields {
+		if !f.required && !allow[name] {
+			v.Field(f.index).SetZero()
+		}
+	}
+}
@@ -0,0 +1,267 @@
+package revenium
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"goa.design/goa-ai/runtime/agent/model"
+)
+
+// gatewayMaxBodyBytes bounds how much of a gateway response is buffered for
+// usage parsing. Larger responses are passed through but not metered.
+const gatewayMaxBodyBytes = 4 << 20
+
+// GatewayFieldPaths maps metering fields to locations in a gateway's JSON
+// response. Paths are dot-separated object keys, with numeric segments
+// indexing arrays (e.g., "choices.0.finish_reason"). Empty paths use the
+// defaults noted on each field; set a path to "-" to skip a field.
+type GatewayFieldPaths struct {
+	// Model is the model name. Defaults to "model".
+	Model string
+
+	// Provider is the LLM provider. Defaults to "provider".
+	Provider string
+
+	// InputTokens is the input token count. Defaults to "usage.input_tokens".
+	InputTokens string
+
+	// OutputTokens is the output token count. Defaults to "usage.output_tokens".
+	OutputTokens string
+
+	// TotalTokens is the provider-reported total, used with
+	// TotalTokensFromProvider. Defaults to "usage.total_tokens".
+	TotalTokens string
+
+	// CacheReadTokens is the cache read token count. Defaults to
+	// "usage.cache_read_tokens".
+	CacheReadTokens string
+
+	// CacheWriteTokens is the cache creation token count. Defaults to
+	// "usage.cache_write_tokens".
+	CacheWriteTokens string
+
+	// StopReason is the provider stop reason, mapped like other completions.
+	// Defaults to "stop_reason".
+	StopReason string
+}
+
+// GatewayMeteringHandler wraps the http.Handler of an internal LLM gateway and
+// meters each successful non-streaming response by reading token usage from
+// the response body, so usage is metered uniformly at the gateway instead of
+// in every client. The response is passed through to the caller unchanged.
+//
+// Trace, MeteringContext, and other per-request overrides are read from the
+// request context, so upstream middleware can set them as usual.
+type GatewayMeteringHandler struct {
+	// Next is the wrapped gateway handler.
+	Next http.Handler
+
+	// Meter is the metering client.
+	Meter *Meter
+
+	// Paths locates usage fields in the response body.
+	Paths GatewayFieldPaths
+
+	// Provider is reported when the response has no provider field.
+	// If empty, defaults to "unknown".
+	Provider string
+
+	// Model is reported when the response has no model field. Responses
+	// with neither are not metered, since the model is required.
+	Model string
+
+	// AgentID is reported as the payload's agent, if set.
+	AgentID string
+}
+
+func (h *GatewayMeteringHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Skip metering if Meter is not configured
+	if h.Meter == nil {
+		h.Next.ServeHTTP(w, r)
+		return
+	}
+
+	start := time.Now()
+	rec := &gatewayRecorder{ResponseWriter: w, status: http.StatusOK}
+	h.Next.ServeHTTP(rec, r)
+	end := time.Now()
+
+	if rec.status < 200 || rec.status >= 300 {
+		return
+	}
+	if rec.overflow {
+		h.Meter.logger.Warn("gateway response exceeds %d bytes, not metered (%s %s)", gatewayMaxBodyBytes, r.Method, r.URL.Path)
+		return
+	}
+	payload, ok := h.buildPayload(r, rec.body.Bytes(), start, end)
+	if !ok {
+		return
+	}
+	h.Meter.SendAsync(r.Context(), payload)
+}
+
+// buildPayload parses a gateway response body into a metering payload. It
+// reports false when the body is not JSON or carries no token usage or model.
+func (h *GatewayMeteringHandler) buildPayload(r *http.Request, body []byte, start, end time.Time) (*MeteringPayload, bool) {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var doc any
+	if err := dec.Decode(&doc); err != nil {
+		h.Meter.logger.Debug("gateway response is not JSON, not metered (%s %s): %v", r.Method, r.URL.Path, err)
+		return nil, false
+	}
+
+	paths := h.Paths
+	input := jsonPathInt(doc, pathOr(paths.InputTokens, "usage.input_tokens"))
+	output := jsonPathInt(doc, pathOr(paths.OutputTokens, "usage.output_tokens"))
+	if input == 0 && output == 0 {
+		h.Meter.logger.Debug("gateway response has no token usage, not metered (%s %s)", r.Method, r.URL.Path)
+		return nil, false
+	}
+	modelName := jsonPathString(doc, pathOr(paths.Model, "model"))
+	if modelName == "" {
+		modelName = h.Model
+	}
+	if modelName == "" {
+		h.Meter.logger.Warn("gateway response has no model and no fallback Model is set, not metered (%s %s)", r.Method, r.URL.Path)
+		return nil, false
+	}
+	provider := jsonPathString(doc, pathOr(paths.Provider, "provider"))
+	if provider == "" {
+		provider = h.Provider
+	}
+	if provider == "" {
+		provider = "unknown"
+	}
+
+	ctx := r.Context()
+	stopReason := jsonPathString(doc, pathOr(paths.StopReason, "stop_reason"))
+	payload := &MeteringPayload{
+		Model:            modelName,
+		InputTokenCount:  input,
+		OutputTokenCount: output,
+		TotalTokenCount: h.Meter.totalTokens(model.TokenUsage{
+			InputTokens:  input,
+			OutputTokens: output,
+			TotalTokens:  jsonPathInt(doc, pathOr(paths.TotalTokens, "usage.total_tokens")),
+		}),
+		StopReason:              h.Meter.mapStopReason(stopReason),
+		RequestTime:             start.UTC().Format(iso8601),
+		CompletionStartTime:     start.UTC().Format(iso8601),
+		ResponseTime:            end.UTC().Format(iso8601),
+		RequestDuration:         end.Sub(start).Milliseconds(),
+		Provider:                provider,
+		BillingUnit:             h.Meter.billingUnit(ctx),
+		Agent:                   h.AgentID,
+		CacheReadTokenCount:     jsonPathInt(doc, pathOr(paths.CacheReadTokens, "usage.cache_read_tokens")),
+		CacheCreationTokenCount: jsonPathInt(doc, pathOr(paths.CacheWriteTokens, "usage.cache_write_tokens")),
+		ContentFiltered:         isContentFiltered(stopReason),
+	}
+	applyTraceContext(payload, h.Meter.traceContext(ctx))
+	h.Meter.applyCacheTokenPolicy(payload)
+	return payload, true
+}
+
+// gatewayRecorder passes a response through while buffering its body, up to
+// gatewayMaxBodyBytes, for usage parsing.
+type gatewayRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+	overflow    bool
+}
+
+func (g *gatewayRecorder) WriteHeader(status int) {
+	if !g.wroteHeader {
+		g.status = status
+		g.wroteHeader = true
+	}
+	g.ResponseWriter.WriteHeader(status)
+}
+
+func (g *gatewayRecorder) Write(b []byte) (int, error) {
+	g.wroteHeader = true
+	if !g.overflow {
+		if g.body.Len()+len(b) > gatewayMaxBodyBytes {
+			g.overflow = true
+			g.body.Reset()
+		} else {
+			g.body.Write(b)
+		}
+	}
+	return g.ResponseWriter.Write(b)
+}
+
+// Unwrap exposes the underlying ResponseWriter to http.ResponseController.
+func (g *gatewayRecorder) Unwrap() http.ResponseWriter {
+	return g.ResponseWriter
+}
+
+// pathOr returns path, or def when path is empty. The path "-" disables the
+// field.
+func pathOr(path, def string) string {
+	switch path {
+	case "":
+		return def
+	case "-":
+		return ""
+	default:
+		return path
+	}
+}
+
+// jsonPathLookup resolves a dot-separated path in a decoded JSON document.
+func jsonPathLookup(doc any, path string) (any, bool) {
+	if path == "" {
+		return nil, false
+	}
+	cur := doc
+	for _, seg := range strings.Split(path, ".") {
+		switch node := cur.(type) {
+		case map[string]any:
+			next, ok := node[seg]
+			if !ok {
+				return nil, false
+			}
+			cur = next
+		case []any:
+			i, err := strconv.Atoi(seg)
+			if err != nil || i < 0 || i >= len(node) {
+				return nil, false
+			}
+			cur = node[i]
+		default:
+			return nil, false
+		}
+	}
+	return cur, true
+}
+
+// jsonPathString returns the string at path, or "" when absent.
+func jsonPathString(doc any, path string) string {
+	v, _ := jsonPathLookup(doc, path)
+	s, _ := v.(string)
+	return s
+}
+
+// jsonPathInt returns the number at path as an int, or 0 when absent.
+func jsonPathInt(doc any, path string) int {
+	v, _ := jsonPathLookup(doc, path)
+	n, ok := v.(json.Number)
+	if !ok {
+		return 0
+	}
+	if i, err := n.Int64(); err == nil {
+		return int(i)
+	}
+	f, _ := n.Float64()
+	return int(f)
+}
+
+// Compile-time interface satisfaction check.
+var _ http.Handler = (*GatewayMeteringHandler)(nil)
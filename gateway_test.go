@@ -0,0 +1,163 @@
+package revenium
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// gatewayResponse is an OpenAI-style completion with usage in nonstandard
+// locations, for exercising GatewayFieldPaths.
+const gatewayResponse = `{
+	"model": "gpt-4o",
+	"choices": [{"finish_reason": "stop"}, {"finish_reason": "length"}],
+	"usage": {"prompt_tokens": 12, "completion_tokens": 7, "cache_read_tokens": 3}
+}`
+
+// serveGateway sends one request through h, with Next answering status and
+// body, and returns the response the client received.
+func serveGateway(t *testing.T, h *GatewayMeteringHandler, status int, body string) *http.Response {
+	t.Helper()
+	h.Next = http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		_, _ = io.WriteString(w, body)
+	})
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil))
+	if h.Meter != nil {
+		h.Meter.Flush()
+	}
+	return rec.Result()
+}
+
+// readBody returns the response body as a string.
+func readBody(t *testing.T, resp *http.Response) string {
+	t.Helper()
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("reading body: %v", err)
+	}
+	return string(b)
+}
+
+func TestGatewayFieldPaths(t *testing.T) {
+	m, store := newTestMeter(t)
+	h := &GatewayMeteringHandler{
+		Meter:    m,
+		Provider: "openai",
+		Paths: GatewayFieldPaths{
+			InputTokens:     "usage.prompt_tokens",
+			OutputTokens:    "usage.completion_tokens",
+			StopReason:      "choices.1.finish_reason",
+			CacheReadTokens: "-",
+		},
+	}
+	resp := serveGateway(t, h, http.StatusOK, gatewayResponse)
+
+	if got := readBody(t, resp); got != gatewayResponse {
+		t.Errorf("client body = %q, want the gateway response unchanged", got)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("client status = %d, want 200", resp.StatusCode)
+	}
+	payloads := store.All()
+	if len(payloads) != 1 {
+		t.Fatalf("got %d payloads, want 1", len(payloads))
+	}
+	p := payloads[0]
+	if p.Model != "gpt-4o" || p.Provider != "openai" {
+		t.Errorf("model/provider = %q/%q, want gpt-4o/openai", p.Model, p.Provider)
+	}
+	if p.InputTokenCount != 12 || p.OutputTokenCount != 7 {
+		t.Errorf("tokens = %d/%d, want 12/7", p.InputTokenCount, p.OutputTokenCount)
+	}
+	if p.StopReason != StopReasonTokenLimit {
+		t.Errorf("StopReason = %q, want %q from choices.1", p.StopReason, StopReasonTokenLimit)
+	}
+	if p.CacheReadTokenCount != 0 {
+		t.Errorf("CacheReadTokenCount = %d, want 0 for a path set to \"-\"", p.CacheReadTokenCount)
+	}
+}
+
+func TestJSONPathLookup(t *testing.T) {
+	doc := map[string]any{
+		"a": []any{map[string]any{"b": "first"}, "second"},
+	}
+	tests := []struct {
+		path string
+		want any
+		ok   bool
+	}{
+		{"a.0.b", "first", true},
+		{"a.1", "second", true},
+		{"a.2", nil, false},
+		{"a.-1", nil, false},
+		{"a.x", nil, false},
+		{"a.1.b", nil, false},
+		{"missing", nil, false},
+		{"", nil, false},
+	}
+	for _, tt := range tests {
+		got, ok := jsonPathLookup(doc, tt.path)
+		if ok != tt.ok || (ok && got != tt.want) {
+			t.Errorf("jsonPathLookup(%q) = %v, %v; want %v, %v", tt.path, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestGatewaySkipsUnmeterableResponses(t *testing.T) {
+	usage := `{"model": "m", "usage": {"input_tokens": 1, "output_tokens": 1}}`
+	oversize := `{"model": "m", "usage": {"input_tokens": 1, "output_tokens": 1}, "pad": "` +
+		strings.Repeat("x", gatewayMaxBodyBytes) + `"}`
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		h      GatewayMeteringHandler
+	}{
+		{"non-2xx", http.StatusBadGateway, usage, GatewayMeteringHandler{}},
+		{"over 4MB", http.StatusOK, oversize, GatewayMeteringHandler{}},
+		{"not JSON", http.StatusOK, "plain text", GatewayMeteringHandler{}},
+		{"no usage", http.StatusOK, `{"model": "m"}`, GatewayMeteringHandler{}},
+		{"no model", http.StatusOK, `{"usage": {"input_tokens": 1}}`, GatewayMeteringHandler{}},
+		{"model disabled", http.StatusOK, usage, GatewayMeteringHandler{Paths: GatewayFieldPaths{Model: "-"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, store := newTestMeter(t)
+			h := tt.h
+			h.Meter = m
+			resp := serveGateway(t, &h, tt.status, tt.body)
+			if resp.StatusCode != tt.status {
+				t.Errorf("client status = %d, want %d", resp.StatusCode, tt.status)
+			}
+			if got := readBody(t, resp); got != tt.body {
+				t.Errorf("client body changed (%d bytes, want %d)", len(got), len(tt.body))
+			}
+			if n := store.Len(); n != 0 {
+				t.Errorf("got %d payloads, want 0", n)
+			}
+		})
+	}
+}
+
+func TestGatewayModelFallback(t *testing.T) {
+	m, store := newTestMeter(t)
+	h := &GatewayMeteringHandler{Meter: m, Model: "internal-llm"}
+	serveGateway(t, h, http.StatusOK, `{"usage": {"input_tokens": 4, "output_tokens": 2}}`)
+	payloads := store.All()
+	if len(payloads) != 1 || payloads[0].Model != "internal-llm" {
+		t.Fatalf("payloads = %+v, want one with model internal-llm", payloads)
+	}
+}
+
+func TestGatewayWithoutMeter(t *testing.T) {
+	h := &GatewayMeteringHandler{}
+	resp := serveGateway(t, h, http.StatusOK, gatewayResponse)
+	if got := readBody(t, resp); got != gatewayResponse {
+		t.Errorf("client body = %q, want the gateway response unchanged", got)
+	}
+}
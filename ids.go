@@ -0,0 +1,27 @@
+package revenium
+
+import (
+	"crypto/rand"
+	"fmt"
+)
+
+// newUUID returns a random (version 4) UUID string, e.g.
+// "f47ac10b-58cc-4372-a567-0e02b2c3d479".
+func newUUID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])  // crypto/rand.Read never returns an error
+	b[6] = b[6]&0x0f | 0x40 // version 4
+	b[8] = b[8]&0x3f | 0x80 // RFC 4122 variant
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// newID returns a new trace, transaction, or correlation ID from the
+// configured IDGenerator, or a random UUID by default.
+func (m *Meter) newID() string {
+	if m.cfg.IDGenerator != nil {
+		if id := m.cfg.IDGenerator(); id != "" {
+			return id
+		}
+	}
+	return newUUID()
+}
@@ -0,0 +1,84 @@
+package revenium
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// JWTOption configures SubscriberFromJWT.
+type JWTOption func(*jwtClaimNames)
+
+// jwtClaimNames names the claims SubscriberFromJWT reads.
+type jwtClaimNames struct {
+	id, email string
+}
+
+// WithJWTIDClaim sets the claim used as the subscriber ID. Defaults to "sub".
+func WithJWTIDClaim(name string) JWTOption {
+	return func(n *jwtClaimNames) { n.id = name }
+}
+
+// WithJWTEmailClaim sets the claim used as the subscriber email. Defaults to
+// "email".
+func WithJWTEmailClaim(name string) JWTOption {
+	return func(n *jwtClaimNames) { n.email = name }
+}
+
+// SubscriberFromJWT builds a SubscriberResource from the claims of a JWT,
+// typically the caller's bearer token, so middleware can pass its ID and Email
+// to WithSubscriberInfo when building a MeteringContext. A leading "Bearer "
+// is stripped. The signature is NOT verified: authenticate the token before
+// trusting the subscriber it names.
+//
+// Malformed tokens, and tokens with neither claim, return a *ReveniumError of
+// type ErrorTypeValidation.
+func SubscriberFromJWT(token string, opts ...JWTOption) (*SubscriberResource, error) {
+	names := jwtClaimNames{id: "sub", email: "email"}
+	for _, opt := range opts {
+		opt(&names)
+	}
+
+	token = strings.TrimSpace(token)
+	if len(token) > 7 && strings.EqualFold(token[:7], "bearer ") {
+		token = strings.TrimSpace(token[7:])
+	}
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, newValidationError(fmt.Sprintf("malformed JWT: expected 3 segments, got %d", len(parts)), nil)
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return nil, newValidationError("malformed JWT: invalid claims encoding", err)
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var claims map[string]any
+	if err := dec.Decode(&claims); err != nil {
+		return nil, newValidationError("malformed JWT: invalid claims JSON", err)
+	}
+
+	sub := &SubscriberResource{
+		ID:    jwtClaimString(claims, names.id),
+		Email: jwtClaimString(claims, names.email),
+	}
+	if sub.ID == "" && sub.Email == "" {
+		return nil, newValidationError(fmt.Sprintf("JWT has no %q or %q claim", names.id, names.email), nil)
+	}
+	return sub, nil
+}
+
+// jwtClaimString returns a string or numeric claim as a string, or "" when
+// the claim is absent or of another type.
+func jwtClaimString(claims map[string]any, name string) string {
+	switch v := claims[name].(type) {
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	default:
+		return ""
+	}
+}
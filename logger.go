@@ -2,33 +2,55 @@ package revenium
 
 import "log"
 
+// Level is the minimum severity a Logger emits.
+type Level int
+
+const (
+	// LevelDebug emits all messages, including debug output.
+	LevelDebug Level = iota - 1
+	// LevelInfo emits info, warn, and error messages. This is the default.
+	LevelInfo
+	// LevelWarn emits warn and error messages.
+	LevelWarn
+	// LevelError emits error messages only.
+	LevelError
+	// LevelSilent suppresses all output.
+	LevelSilent
+)
+
 // Logger provides simple leveled logging for the revenium package.
 type Logger struct {
-	debug bool
+	level Level
 }
 
-func newLogger(debug bool) *Logger {
-	return &Logger{debug: debug}
+func newLogger(level Level) *Logger {
+	return &Logger{level: level}
 }
 
 // Debug logs a message at debug level (only when debug mode is enabled).
 func (l *Logger) Debug(msg string, args ...any) {
-	if l.debug {
+	if l.level <= LevelDebug {
 		log.Printf("[revenium:debug] "+msg, args...)
 	}
 }
 
 // Info logs a message at info level.
 func (l *Logger) Info(msg string, args ...any) {
-	log.Printf("[revenium:info] "+msg, args...)
+	if l.level <= LevelInfo {
+		log.Printf("[revenium:info] "+msg, args...)
+	}
 }
 
 // Warn logs a message at warn level.
 func (l *Logger) Warn(msg string, args ...any) {
-	log.Printf("[revenium:warn] "+msg, args...)
+	if l.level <= LevelWarn {
+		log.Printf("[revenium:warn] "+msg, args...)
+	}
 }
 
 // Error logs a message at error level.
 func (l *Logger) Error(msg string, args ...any) {
-	log.Printf("[revenium:error] "+msg, args...)
+	if l.level <= LevelError {
+		log.Printf("[revenium:error] "+msg, args...)
+	}
 }
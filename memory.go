@@ -0,0 +1,69 @@
+package revenium
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+)
+
+// InMemoryStore is a Transport that keeps payloads in memory instead of
+// sending them, for demos, examples, and tests that should run without an API
+// key or network access. It is safe for concurrent use.
+type InMemoryStore struct {
+	mu       sync.Mutex
+	payloads []MeteringPayload
+}
+
+// NewInMemoryStore returns an empty InMemoryStore.
+func NewInMemoryStore() *InMemoryStore {
+	return &InMemoryStore{}
+}
+
+// Send stores a copy of the payload as it would have been sent.
+func (s *InMemoryStore) Send(_ context.Context, _ *MeteringPayload, body []byte) error {
+	var stored MeteringPayload
+	if err := json.Unmarshal(body, &stored); err != nil {
+		return newMeteringError("failed to decode payload", err)
+	}
+	s.mu.Lock()
+	s.payloads = append(s.payloads, stored)
+	s.mu.Unlock()
+	return nil
+}
+
+// All returns the stored payloads in the order they were sent.
+func (s *InMemoryStore) All() []MeteringPayload {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]MeteringPayload(nil), s.payloads...)
+}
+
+// Filter returns the stored payloads for which keep returns true.
+func (s *InMemoryStore) Filter(keep func(*MeteringPayload) bool) []MeteringPayload {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []MeteringPayload
+	for i := range s.payloads {
+		if keep(&s.payloads[i]) {
+			out = append(out, s.payloads[i])
+		}
+	}
+	return out
+}
+
+// Len returns the number of stored payloads.
+func (s *InMemoryStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.payloads)
+}
+
+// Reset discards all stored payloads.
+func (s *InMemoryStore) Reset() {
+	s.mu.Lock()
+	s.payloads = nil
+	s.mu.Unlock()
+}
+
+// Compile-time interface satisfaction check.
+var _ Transport = (*InMemoryStore)(nil)
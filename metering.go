@@ -4,14 +4,51 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"math/rand/v2"
+	"net"
 	"net/http"
+	"net/http/httptrace"
+	"os"
+	"runtime/debug"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
-const meteringPath = "/meter/v2/ai/completions"
+const (
+	meteringPath = "/meter/v2/ai/completions"
+
+	// verifyOnStartTimeout bounds the WithVerifyOnStart self-test so a
+	// misconfigured endpoint cannot hang startup.
+	verifyOnStartTimeout = 10 * time.Second
+
+	// sendTimeout bounds each async send, including retries.
+	sendTimeout = 30 * time.Second
+
+	// startupRequeueDelay is the pause before re-queuing a payload that failed
+	// to connect during the WithStartupGrace window.
+	startupRequeueDelay = time.Second
+
+	// maxRetries is the most retries of a failed send, with or without
+	// WithRetryDecider.
+	maxRetries = 3
+
+	// retryBaseBackoff is the first retry's delay, doubled for each later
+	// retry, and the shortest delay a WithRetryDecider can choose.
+	retryBaseBackoff = time.Second
+
+	// phaseRepeatWindow is how long a repeated workflow phase event for the
+	// same run is treated as a duplicate by MeteringSink.
+	phaseRepeatWindow = 5 * time.Second
+)
 
 // MeteringPayload matches the AICompletionMetadataResource schema from the
 // Revenium metering API OpenAPI spec.
@@ -31,29 +68,66 @@ type MeteringPayload struct {
 	BillingUnit         string `json:"billingUnit"`
 
 	// Optional fields
-	TransactionID    string `json:"transactionId,omitempty"`
-	TraceID          string `json:"traceId,omitempty"`
-	TraceName        string `json:"traceName,omitempty"`
-	TraceType        string `json:"traceType,omitempty"`
-	ParentTxnID      string `json:"parentTransactionId,omitempty"`
-	Agent            string `json:"agent,omitempty"`
-	SquadID          string `json:"squadId,omitempty"`
-	SquadName        string `json:"squadName,omitempty"`
-	OrganizationName string `json:"organizationName,omitempty"`
-	Environment      string `json:"environment,omitempty"`
-	MiddlewareSource string `json:"middlewareSource,omitempty"`
-
-	CacheReadTokenCount     int `json:"cacheReadTokenCount,omitempty"`
-	CacheCreationTokenCount int `json:"cacheCreationTokenCount,omitempty"`
+	TransactionID     string `json:"transactionId,omitempty"`
+	ProviderRequestID string `json:"providerRequestId,omitempty"`
+	ProviderRetries   int    `json:"providerRetries,omitempty"`
+	ModelVariant      string `json:"modelVariant,omitempty"`
+	TraceID           string `json:"traceId,omitempty"`
+	SessionID         string `json:"sessionId,omitempty"`
+	TraceName         string `json:"traceName,omitempty"`
+	TraceType         string `json:"traceType,omitempty"`
+	ParentTxnID       string `json:"parentTransactionId,omitempty"`
+	Agent             string `json:"agent,omitempty"`
+	AgentVersion      string `json:"agentVersion,omitempty"`
+	PlanPhase         string `json:"planPhase,omitempty"`
+	Step              string `json:"step,omitempty"`
+	Experiment        string `json:"experiment,omitempty"`
+	ExperimentArm     string `json:"experimentArm,omitempty"`
+	LatencyBucket     string `json:"latencyBucket,omitempty"`
+	Abandoned         bool   `json:"abandoned,omitempty"`
+	ContentFiltered   bool   `json:"contentFiltered,omitempty"`
+	UsedTools         bool   `json:"usedTools,omitempty"`
+	ToolCallCount     int    `json:"toolCallCount,omitempty"`
+	InputChars        int    `json:"inputChars,omitempty"`
+	OutputChars       int    `json:"outputChars,omitempty"`
+	SquadID           string `json:"squadId,omitempty"`
+	SquadName         string `json:"squadName,omitempty"`
+	OrganizationName  string `json:"organizationName,omitempty"`
+	Environment       string `json:"environment,omitempty"`
+	MiddlewareSource  string `json:"middlewareSource,omitempty"`
+	FrameworkVersion  string `json:"frameworkVersion,omitempty"`
+
+	CacheReadTokenCount     int  `json:"cacheReadTokenCount,omitempty"`
+	CacheCreationTokenCount int  `json:"cacheCreationTokenCount,omitempty"`
+	CacheRequested          bool `json:"cacheRequested,omitempty"`
+
+	BilledQuantity     float64 `json:"billedQuantity,omitempty"`
+	ContextUtilization float64 `json:"contextUtilization,omitempty"`
+
+	InputTokenBreakdown map[string]int `json:"inputTokenBreakdown,omitempty"`
+
+	Tags map[string]string `json:"tags,omitempty"`
 
 	SystemPrompt     string `json:"systemPrompt,omitempty"`
 	InputMessages    string `json:"inputMessages,omitempty"`
 	OutputResponse   string `json:"outputResponse,omitempty"`
 	PromptsTruncated bool   `json:"promptsTruncated,omitempty"`
 
+	RawUsage json.RawMessage `json:"rawUsage,omitempty"`
+	SelfTest bool            `json:"selfTest,omitempty"`
+
+	Hostname  string `json:"hostname,omitempty"`
+	PID       int    `json:"pid,omitempty"`
+	GoVersion string `json:"goVersion,omitempty"`
+
 	SubscriptionID string              `json:"subscriptionId,omitempty"`
 	ProductName    string              `json:"productName,omitempty"`
 	Subscriber     *SubscriberResource `json:"subscriber,omitempty"`
+
+	// AdditionalSubscribers lists secondary subscribers sharing the session
+	// with Subscriber. SubscriberSplit tells Revenium how to apportion usage.
+	AdditionalSubscribers []*SubscriberResource `json:"additionalSubscribers,omitempty"`
+	SubscriberSplit       string                `json:"subscriberSplit,omitempty"`
 }
 
 // SubscriberResource identifies the end-user making the AI request.
@@ -81,30 +155,175 @@ const (
 	StopReasonCancelled       = "CANCELLED"
 )
 
+// Allowed billingUnit values per the Revenium API.
+const (
+	BillingUnitPerToken   = "PER_TOKEN"
+	BillingUnitPerRequest = "PER_REQUEST"
+)
+
+// IsValidBillingUnit reports whether unit is a billingUnit value accepted by
+// the Revenium API.
+func IsValidBillingUnit(unit string) bool {
+	switch unit {
+	case BillingUnitPerToken, BillingUnitPerRequest:
+		return true
+	default:
+		return false
+	}
+}
+
+// Allowed subscriberSplit values. With SubscriberSplitPrimary, Revenium
+// attributes all usage to the primary subscriber and records the additional
+// subscribers for reporting only. With SubscriberSplitEven, usage is divided
+// evenly across the primary and additional subscribers.
+const (
+	SubscriberSplitPrimary = "PRIMARY"
+	SubscriberSplitEven    = "EVEN"
+)
+
+// isValidSubscriberSplit reports whether split is a subscriberSplit value
+// accepted by the Revenium API.
+func isValidSubscriberSplit(split string) bool {
+	return split == SubscriberSplitPrimary || split == SubscriberSplitEven
+}
+
+// isValidStopReason reports whether reason is a stopReason value accepted by
+// the Revenium API.
+func isValidStopReason(reason string) bool {
+	switch reason {
+	case StopReasonEnd, StopReasonEndSequence, StopReasonTimeout, StopReasonTokenLimit,
+		StopReasonCostLimit, StopReasonCompletionLimit, StopReasonError, StopReasonCancelled:
+		return true
+	default:
+		return false
+	}
+}
+
+// validate checks enum fields the API would reject, so malformed payloads fail
+// fast instead of exhausting retries on a 400.
+func (p *MeteringPayload) validate() error {
+	if !IsValidBillingUnit(p.BillingUnit) {
+		return newValidationError(fmt.Sprintf("invalid billingUnit %q", p.BillingUnit), nil)
+	}
+	if !isValidStopReason(p.StopReason) {
+		return newValidationError(fmt.Sprintf("invalid stopReason %q", p.StopReason), nil)
+	}
+	if p.SubscriberSplit != "" && !isValidSubscriberSplit(p.SubscriberSplit) {
+		return newValidationError(fmt.Sprintf("invalid subscriberSplit %q", p.SubscriberSplit), nil)
+	}
+	return nil
+}
+
 // MapStopReason maps provider-specific stop reasons to Revenium's enum values.
+// Empty and unrecognized reasons map to StopReasonEnd.
 func MapStopReason(providerReason string) string {
-	switch providerReason {
-	case "stop", "end_turn", "complete":
-		return StopReasonEnd
-	case "tool_calls", "tool_use":
-		return StopReasonEnd
-	case "length", "max_tokens":
-		return StopReasonTokenLimit
-	case "content_filter":
-		return StopReasonEnd
-	case "":
-		return StopReasonEnd
-	default:
-		return StopReasonEnd
+	if reason, ok := lookupStopReason(providerReason); ok {
+		return reason
 	}
+	return StopReasonEnd
+}
+
+// stopReasonMappings maps provider-specific stop reasons to Revenium's enum
+// values. It is read-only; use StopReasonMappings for a copy.
+var stopReasonMappings = map[string]string{
+	"stop":           StopReasonEnd,
+	"end_turn":       StopReasonEnd,
+	"complete":       StopReasonEnd,
+	"tool_calls":     StopReasonEnd,
+	"tool_use":       StopReasonEnd,
+	"length":         StopReasonTokenLimit,
+	"max_tokens":     StopReasonTokenLimit,
+	"content_filter": StopReasonEnd,
+}
+
+// StopReasonMappings returns a copy of the provider stop reason table used by
+// MapStopReason. Reasons not in the table map to StopReasonEnd, or to the
+// meter's WithDefaultStopReason value. Use WithStopReasonMapping to override
+// entries for a Meter.
+func StopReasonMappings() map[string]string {
+	mappings := make(map[string]string, len(stopReasonMappings))
+	for k, v := range stopReasonMappings {
+		mappings[k] = v
+	}
+	return mappings
+}
+
+// contentFilterReasons lists provider stop reasons, lowercased, that indicate
+// the response was blocked or cut short by a safety filter.
+var contentFilterReasons = map[string]bool{
+	"content_filter":       true,
+	"content_filtered":     true,
+	"refusal":              true,
+	"safety":               true,
+	"guardrail_intervened": true,
+}
+
+// isContentFiltered reports whether a provider stop reason indicates a safety
+// refusal. It sets the contentFiltered field, which surfaces refusals without
+// changing the stopReason mapping.
+func isContentFiltered(providerReason string) bool {
+	return contentFilterReasons[strings.ToLower(providerReason)]
+}
+
+// lookupStopReason maps a recognized provider stop reason, reporting false for
+// empty or unrecognized reasons.
+func lookupStopReason(providerReason string) (string, bool) {
+	reason, ok := stopReasonMappings[providerReason]
+	return reason, ok
+}
+
+// mapStopReason maps a provider stop reason like MapStopReason, applying the
+// meter's mapping overrides first and using the configured default stop reason
+// for empty or unrecognized reasons.
+func (m *Meter) mapStopReason(providerReason string) string {
+	if reason, ok := m.cfg.StopReasonOverrides[providerReason]; ok {
+		return reason
+	}
+	if reason, ok := lookupStopReason(providerReason); ok {
+		return reason
+	}
+	if m.cfg.DefaultStopReason != "" {
+		return m.cfg.DefaultStopReason
+	}
+	return StopReasonEnd
 }
 
 // Meter is the core metering client that sends payloads to the Revenium API.
 type Meter struct {
-	cfg    *Config
-	logger *Logger
-	wg     sync.WaitGroup
-	traces sync.Map // runID → traceID for cross-agent trace correlation
+	cfg        *Config
+	logger     *Logger
+	wg         sync.WaitGroup
+	traces     sync.Map // runID → traceID for cross-agent trace correlation
+	toolErrors sync.Map // runID → *atomic.Int64 count of failed tool calls
+	ignored    sync.Map // runID → struct{} for runs of ignored agents
+	phases     sync.Map // runID → workflowPhase last seen by MeteringSink
+	httpClient atomic.Pointer[http.Client]
+	startedAt  time.Time
+	source     string // middlewareSource, with any reseller prefix
+	userAgent  string
+	hostname   string
+	pid        int
+	stats      meterStats
+	results    chan SendResult
+	debugMu    sync.Mutex // serializes writes to cfg.DebugWriter
+	otel       *otelInstruments
+	events     EventSink
+	breaker    *circuitBreaker
+	allowlist  map[string]bool // from cfg.FieldAllowlist; nil sends all fields
+	closeMu    sync.RWMutex    // orders SendAsync's wg.Add before Close's Wait
+	closed     bool
+	inFlight   atomic.Int64
+	queue      chan sendJob // WithMaxConcurrency worker queue; nil when unbounded
+
+	queueMu      sync.RWMutex // orders dispatch's queue sends before its close
+	queueStopped bool
+
+	abortMu     sync.Mutex // guards abortCtx and abortCancel
+	abortCtx    context.Context
+	abortCancel context.CancelFunc
+
+	badTraceCtx    sync.Once // warns about the first mistyped trace context value
+	badMeteringCtx sync.Once // warns about the first mistyped metering context value
 }
 
 // RegisterTrace stores the traceID associated with a run so child runs can
@@ -134,6 +353,62 @@ func (m *Meter) UnregisterTrace(runID string) {
 	m.logger.Debug("unregistered trace: run=%s", runID)
 }
 
+// recordToolError counts a failed tool invocation for runID.
+func (m *Meter) recordToolError(runID string) {
+	m.stats.toolErrors.Add(1)
+	v, _ := m.toolErrors.LoadOrStore(runID, new(atomic.Int64))
+	v.(*atomic.Int64).Add(1)
+}
+
+// takeToolErrors returns and clears the failed tool invocation count for runID.
+func (m *Meter) takeToolErrors(runID string) int64 {
+	v, ok := m.toolErrors.LoadAndDelete(runID)
+	if !ok {
+		return 0
+	}
+	return v.(*atomic.Int64).Load()
+}
+
+// workflowPhase is the last workflow phase seen for a run.
+type workflowPhase struct {
+	phase string
+	at    time.Time
+}
+
+// repeatedPhase records phase as the latest workflow phase of runID and
+// reports whether it repeats the previous one within phaseRepeatWindow. Terminal
+// phases are forgotten once the window passes.
+func (m *Meter) repeatedPhase(runID, phase string, terminal bool) bool {
+	now := time.Now()
+	cur := &workflowPhase{phase: phase, at: now}
+	if v, loaded := m.phases.Swap(runID, cur); loaded {
+		prev := v.(*workflowPhase)
+		if prev.phase == phase && now.Sub(prev.at) < phaseRepeatWindow {
+			return true
+		}
+	}
+	if terminal {
+		time.AfterFunc(phaseRepeatWindow, func() { m.phases.CompareAndDelete(runID, cur) })
+	}
+	return false
+}
+
+// ignoresAgent reports whether agentID matches a WithIgnoredAgents pattern.
+func (m *Meter) ignoresAgent(agentID string) bool {
+	return len(m.cfg.IgnoredAgents) > 0 && matchesAny(m.cfg.IgnoredAgents, agentID)
+}
+
+// ignoreRun marks runID as belonging to an ignored agent.
+func (m *Meter) ignoreRun(runID string) {
+	m.ignored.Store(runID, struct{}{})
+}
+
+// isIgnoredRun reports whether runID belongs to an ignored agent.
+func (m *Meter) isIgnoredRun(runID string) bool {
+	_, ok := m.ignored.Load(runID)
+	return ok
+}
+
 // NewMeter creates a new Meter with the given options.
 func NewMeter(opts ...Option) (*Meter, error) {
 	cfg := &Config{}
@@ -145,10 +420,72 @@ func NewMeter(opts ...Option) (*Meter, error) {
 	if err := cfg.validate(); err != nil {
 		return nil, err
 	}
-	return &Meter{
-		cfg:    cfg,
-		logger: newLogger(cfg.Debug),
-	}, nil
+	m := &Meter{
+		cfg:       cfg,
+		logger:    newLogger(cfg.LogLevel),
+		events:    cfg.EventSink,
+		startedAt: time.Now(),
+	}
+	if m.events == nil {
+		m.events = NopEventSink{}
+	}
+	m.source, m.userAgent = middlewareSource, userAgent
+	if prefix := cfg.MiddlewareSourcePrefix; prefix != "" {
+		m.source = prefix + " " + middlewareSource
+		m.userAgent = prefix + " " + userAgent
+	}
+	m.httpClient.Store(cfg.HTTPClient)
+	if cfg.MeterProvider != nil {
+		instruments, err := newOtelInstruments(cfg.MeterProvider)
+		if err != nil {
+			return nil, newConfigError("failed to create OpenTelemetry instruments", err)
+		}
+		m.otel = instruments
+	}
+	if len(cfg.FieldAllowlist) > 0 {
+		m.allowlist = make(map[string]bool, len(cfg.FieldAllowlist))
+		for _, name := range cfg.FieldAllowlist {
+			m.allowlist[name] = true
+		}
+	}
+	if cfg.BreakerThreshold > 0 {
+		m.breaker = newCircuitBreaker(cfg.BreakerThreshold, cfg.BreakerCooldown)
+	}
+	if cfg.ResultBuffer > 0 {
+		m.results = make(chan SendResult, cfg.ResultBuffer)
+	}
+	if cfg.HostMetadata {
+		if hostname, err := os.Hostname(); err == nil {
+			m.hostname = hostname
+		} else {
+			m.logger.Warn("failed to read hostname: %v", err)
+		}
+		m.pid = os.Getpid()
+	}
+	if cfg.VerifyOnStart {
+		ctx, cancel := context.WithTimeout(context.Background(), verifyOnStartTimeout)
+		defer cancel()
+		if err := m.SelfTest(ctx); err != nil {
+			return nil, newMeteringError("startup verification failed", err)
+		}
+	}
+	// Start workers last so a failed verification leaves nothing running.
+	if cfg.MaxConcurrency > 0 {
+		m.startWorkers(cfg.MaxConcurrency)
+	}
+	return m, nil
+}
+
+// SetHTTPClient replaces the HTTP client used for metering requests. It is
+// safe to call concurrently with sends: requests already in flight complete on
+// the previous client and subsequent requests use the new one. A nil client
+// restores http.DefaultClient.
+func (m *Meter) SetHTTPClient(client *http.Client) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	m.httpClient.Store(client)
+	m.logger.Debug("HTTP client replaced")
 }
 
 // SendAsync sends a metering payload asynchronously. It never blocks the caller.
@@ -159,14 +496,263 @@ func NewMeter(opts ...Option) (*Meter, error) {
 //  1. Payload field already set explicitly
 //  2. MeteringContext from request context (per-request config)
 //  3. Config options (static config)
+//
+// SendAsync does not report whether the payload was dropped (e.g., because the
+// meter is closed or the circuit breaker is open); use TrySend to find out.
 func (m *Meter) SendAsync(ctx context.Context, payload *MeteringPayload) {
-	payload.MiddlewareSource = middlewareSource
-	if payload.Environment == "" {
-		payload.Environment = m.cfg.Environment
+	if !m.prepare(ctx, payload) {
+		return
+	}
+	m.launch(ctx, payload)
+}
+
+// TrySend is like SendAsync but reports whether the payload was accepted for
+// delivery. It returns false without sending when the circuit breaker is open,
+// the meter is closed, the payload is sampled out, or the WithMaxConcurrency
+// queue is full, so latency-sensitive callers can decide whether to retry or
+// degrade. A true result does not mean delivery succeeded; the send still runs
+// in the background. Payloads rejected by the breaker count as failed, as they
+// do when the breaker opens mid-send.
+func (m *Meter) TrySend(ctx context.Context, payload *MeteringPayload) bool {
+	if m.breaker != nil && m.breaker.rejecting() {
+		m.stats.breakerReject.Add(1)
+		m.stats.failed.Add(1)
+		m.logger.Debug("circuit breaker open, rejecting payload (%s)", payloadLogFields(payload))
+		return false
+	}
+	if !m.prepare(ctx, payload) {
+		return false
+	}
+	return m.launch(ctx, payload)
+}
+
+// launch delivers a prepared payload in the background: on a worker when
+// WithMaxConcurrency is set, and on a new goroutine otherwise. It reports
+// false when the worker queue is full and the payload was dropped.
+func (m *Meter) launch(ctx context.Context, payload *MeteringPayload) bool {
+	p := &pendingSend{base: m.detachedContext(ctx), payload: payload}
+	// Capture the abort context now, so a payload still queued when a
+	// shutdown times out is aborted along with the sends in progress.
+	if m.cfg.CancellableShutdown {
+		p.abort = m.abortContext()
+	}
+	return m.dispatch(m.sendJob(p))
+}
+
+// pendingSend is a payload delivered in the background, possibly over several
+// runs when it is re-queued during WithStartupGrace.
+type pendingSend struct {
+	base       context.Context // detached from the caller
+	abort      context.Context // WithCancellableShutdown abort context, or nil
+	payload    *MeteringPayload
+	deadline   time.Time // send timeout, fixed by the first run
+	d          *delivery // nil until the first run
+	requeuedAt time.Time // when the last requeue was scheduled
+}
+
+// sendJob wraps p for dispatch.
+func (m *Meter) sendJob(p *pendingSend) sendJob {
+	return sendJob{
+		run: func() { m.run(p) },
+		drop: func(err error) {
+			defer m.end()
+			if errors.Is(err, errQueueFull) {
+				m.stats.queueDropped.Add(1)
+			} else {
+				m.stats.shutdownDropped.Add(1)
+			}
+			m.abandon(p, newMeteringError("payload not sent", err))
+		},
+	}
+}
+
+// run makes one delivery run for p and marks the send finished, unless p is
+// re-queued: rather than waiting in place, it is dispatched again after
+// startupRequeueDelay so it holds no worker meanwhile. The send timeout
+// spans all runs, and the send is canceled when p.abort, if set, is.
+func (m *Meter) run(p *pendingSend) {
+	requeued := false
+	defer func() {
+		if !requeued {
+			m.end()
+		}
+	}()
+	defer m.recoverPanic("metering send")
+	if p.abort != nil && p.abort.Err() != nil {
+		m.abandon(p, newMeteringError("send aborted by shutdown", p.abort.Err()))
+		return
+	}
+	if p.deadline.IsZero() {
+		p.deadline = time.Now().Add(sendTimeout)
+	}
+	// Use a detached context with a generous timeout so metering is not
+	// canceled when the caller's request context ends.
+	ctx, cancel := context.WithDeadline(p.base, p.deadline)
+	defer cancel()
+	if p.abort != nil {
+		stop := context.AfterFunc(p.abort, cancel)
+		defer stop()
+	}
+
+	if p.d == nil {
+		p.d = m.startDelivery(ctx, p.payload)
+		if p.d.err != nil {
+			_ = m.finishDelivery(p.d)
+			return
+		}
+	} else {
+		p.d.timing.retryDelay += time.Since(p.requeuedAt)
+	}
+	m.attempt(ctx, p.d)
+	if p.d.err != nil && time.Until(p.deadline) > startupRequeueDelay && m.requeueOnStartup(p.payload, p.d.err) {
+		requeued = true
+		p.requeuedAt = time.Now()
+		time.AfterFunc(startupRequeueDelay, func() { m.dispatch(m.sendJob(p)) })
+		return
+	}
+	_ = m.finishDelivery(p.d)
+}
+
+// abandon records p as failed without another delivery attempt.
+func (m *Meter) abandon(p *pendingSend, err error) {
+	if p.d == nil {
+		m.dropPayload(p.payload, err)
+		return
+	}
+	p.d.err = err
+	_ = m.finishDelivery(p.d)
+}
+
+// dropPayload records a payload discarded before any delivery attempt as
+// failed.
+func (m *Meter) dropPayload(payload *MeteringPayload, err error) {
+	m.stats.failed.Add(1)
+	m.logger.Warn("dropping metering payload (%s): %v", payloadLogFields(payload), err)
+	m.events.PayloadDropped(payload, err)
+	m.events.SendFailed(payload, 0, err)
+	m.publishResult(SendResult{Payload: payload, Err: err})
+}
+
+// prepare registers, enriches, and samples a payload before it is sent. It
+// reports false when the payload is dropped; otherwise the caller must call
+// m.end once the send finishes.
+func (m *Meter) prepare(ctx context.Context, payload *MeteringPayload) bool {
+	if !m.begin() {
+		m.stats.shutdownDropped.Add(1)
+		m.logger.Debug("meter closed, dropping payload (%s)", payloadLogFields(payload))
+		return false
+	}
+	m.Enrich(ctx, payload)
+	if !m.sampled(payload) {
+		m.end()
+		m.stats.sampledOut.Add(1)
+		m.logger.Debug("payload sampled out (%s)", payloadLogFields(payload))
+		return false
+	}
+	m.events.PayloadBuilt(payload)
+	return true
+}
+
+// submit sends a completion payload: synchronously inside a child span of
+// ctx when WithInlineMeteringSpan is enabled, and with SendAsync otherwise.
+func (m *Meter) submit(ctx context.Context, payload *MeteringPayload) {
+	if !m.cfg.InlineMeteringSpan {
+		m.SendAsync(ctx, payload)
+		return
+	}
+	if !m.prepare(ctx, payload) {
+		return
+	}
+	defer m.end()
+	defer m.recoverPanic("inline metering send")
+
+	ctx, span := otel.Tracer(instrumentationName).Start(ctx, "revenium.metering.send",
+		trace.WithSpanKind(trace.SpanKindClient))
+	defer span.End()
+	// Keep the span and values but not the caller's cancellation, matching
+	// the detached semantics of async sends.
+	sendCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), sendTimeout)
+	defer cancel()
+	if m.cfg.CancellableShutdown {
+		stop := context.AfterFunc(m.abortContext(), cancel)
+		defer stop()
+	}
+	if err := m.deliver(sendCtx, payload); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "metering send failed")
+	}
+}
+
+// sampled reports whether payload should be sent under the configured sample
+// rates, using the rate for its environment when one is listed. Failed
+// completions and payloads matched by WithAlwaysKeepTokens or WithAlwaysKeep
+// are always sent.
+func (m *Meter) sampled(payload *MeteringPayload) bool {
+	if payload.StopReason == StopReasonError ||
+		(m.cfg.AlwaysKeepTokens > 0 && payload.TotalTokenCount >= m.cfg.AlwaysKeepTokens) ||
+		(m.cfg.AlwaysKeep != nil && m.cfg.AlwaysKeep(payload)) {
+		return true
+	}
+	rate, ok := m.cfg.SampleRates[payload.Environment]
+	if !ok {
+		rate = m.cfg.SampleRate
+	}
+	return rate >= 1 || rand.Float64() < rate
+}
+
+// recoverPanic contains a panic raised on a send goroutine, typically by
+// user-supplied code such as a Transport, EventSink, or HTTP client transport,
+// so one bad callback cannot crash the application. It must be deferred
+// directly.
+func (m *Meter) recoverPanic(where string) {
+	if r := recover(); r != nil {
+		m.stats.panics.Add(1)
+		m.logger.Error("panic in %s: %v\n%s", where, r, debug.Stack())
+	}
+}
+
+// detachedContext returns a context that is never canceled along with parent,
+// carrying only the parent values selected by WithContextValuePropagation. When
+// WithSendContextFunc is configured, its context is returned instead.
+func (m *Meter) detachedContext(parent context.Context) context.Context {
+	if m.cfg.SendContextFunc != nil {
+		if ctx := m.cfg.SendContextFunc(); ctx != nil {
+			return ctx
+		}
+		m.logger.Warn("send context func returned nil, using a detached context")
+	}
+	ctx := context.Background()
+	for _, key := range m.cfg.PropagatedContextKeys {
+		if v := parent.Value(key); v != nil {
+			ctx = context.WithValue(ctx, key, v)
+		}
 	}
+	return ctx
+}
+
+// Enrich fills payload fields that were not set explicitly from the
+// per-request MeteringContext, other context overrides (e.g., WithExperiment),
+// and the static Config, following the precedence documented on SendAsync. It
+// also sets the middleware source and derived fields such as latencyBucket and
+// contextUtilization.
+//
+// SendAsync calls Enrich itself; call it directly to inspect the payload that
+// would be sent, e.g. in tests or when building payloads by hand. Enriching a
+// payload more than once is harmless since set fields are left untouched.
+func (m *Meter) Enrich(ctx context.Context, payload *MeteringPayload) {
+	payload.MiddlewareSource = m.source
+	payload.FrameworkVersion = frameworkVersion
 
 	// Check per-request MeteringContext before falling back to static Config
-	mc := GetMeteringContext(ctx)
+	mc := m.meteringContext(ctx)
+
+	if payload.Environment == "" {
+		if mc != nil && mc.Environment != "" {
+			payload.Environment = mc.Environment
+		} else {
+			payload.Environment = m.cfg.Environment
+		}
+	}
 
 	if payload.OrganizationName == "" {
 		if mc != nil && mc.OrganizationName != "" {
@@ -196,86 +782,617 @@ func (m *Meter) SendAsync(ctx context.Context, payload *MeteringPayload) {
 			payload.Subscriber = m.cfg.Subscriber
 		}
 	}
+	if payload.AdditionalSubscribers == nil {
+		if mc != nil && len(mc.AdditionalSubscribers) > 0 {
+			payload.AdditionalSubscribers = mc.AdditionalSubscribers
+		} else {
+			payload.AdditionalSubscribers = m.cfg.AdditionalSubscribers
+		}
+	}
+	if len(payload.AdditionalSubscribers) > 0 && payload.SubscriberSplit == "" {
+		if mc != nil && mc.SubscriberSplit != "" {
+			payload.SubscriberSplit = mc.SubscriberSplit
+		} else if m.cfg.SubscriberSplit != "" {
+			payload.SubscriberSplit = m.cfg.SubscriberSplit
+		} else {
+			payload.SubscriberSplit = SubscriberSplitPrimary
+		}
+	}
+	applyExperiment(ctx, payload)
+	if payload.SessionID == "" {
+		payload.SessionID = sessionID(ctx)
+	}
+	if payload.ModelVariant == "" {
+		payload.ModelVariant = modelVariant(ctx)
+	}
+	if len(m.cfg.StaticTags) > 0 {
+		tags := make(map[string]string, len(m.cfg.StaticTags)+len(payload.Tags))
+		for k, v := range m.cfg.StaticTags {
+			tags[k] = v
+		}
+		for k, v := range payload.Tags {
+			tags[k] = v
+		}
+		payload.Tags = tags
+	}
+	if payload.BilledQuantity == 0 && payload.BillingUnit != BillingUnitPerToken && m.cfg.QuantityResolver != nil {
+		payload.BilledQuantity = m.cfg.QuantityResolver(payload)
+	}
+	if window, ok := m.cfg.ContextWindows[payload.Model]; ok && payload.ContextUtilization == 0 {
+		payload.ContextUtilization = float64(payload.InputTokenCount) / float64(window)
+	}
+	if payload.LatencyBucket == "" {
+		payload.LatencyBucket = m.latencyBucket(payload.RequestDuration)
+	}
+	if m.cfg.HostMetadata {
+		payload.Hostname = m.hostname
+		payload.PID = m.pid
+		payload.GoVersion = goVersion
+	}
+}
 
-	m.wg.Add(1)
-	go func() {
-		defer m.wg.Done()
-		defer func() {
-			if r := recover(); r != nil {
-				m.logger.Error("panic in metering send: %v", r)
-			}
-		}()
-		// Use a detached context with a generous timeout so metering is not
-		// canceled when the caller's request context ends.
-		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-		defer cancel()
-		if err := m.sendWithRetry(ctx, payload); err != nil {
-			m.logger.Error("failed to send metering payload: %v", err)
+// Latency buckets reported in the latencyBucket payload field.
+const (
+	LatencyBucketFast   = "fast"
+	LatencyBucketNormal = "normal"
+	LatencyBucketSlow   = "slow"
+)
+
+// latencyBucket classifies a request duration in milliseconds, returning ""
+// when latency buckets are not configured.
+func (m *Meter) latencyBucket(durationMs int64) string {
+	if m.cfg.LatencyFastThreshold <= 0 || m.cfg.LatencySlowThreshold <= 0 {
+		return ""
+	}
+	d := time.Duration(durationMs) * time.Millisecond
+	switch {
+	case d < m.cfg.LatencyFastThreshold:
+		return LatencyBucketFast
+	case d >= m.cfg.LatencySlowThreshold:
+		return LatencyBucketSlow
+	default:
+		return LatencyBucketNormal
+	}
+}
+
+// delivery tracks a payload through encoding, sending, and any startup
+// requeues, so that each payload is encoded, shadowed, and reported once.
+type delivery struct {
+	payload       *MeteringPayload
+	body          []byte
+	correlationID string
+	start         time.Time
+	passes        int // sendWithRetry runs so far
+	retries       int
+	timing        sendTiming
+	err           error
+}
+
+// deliver sends an enriched payload with retries, records the outcome in the
+// meter's stats and result channel, and returns the final error. Startup
+// requeues wait in place, within ctx.
+func (m *Meter) deliver(ctx context.Context, payload *MeteringPayload) error {
+	d := m.startDelivery(ctx, payload)
+	if d.err == nil {
+		m.attempt(ctx, d)
+	}
+	for d.err != nil && m.requeueOnStartup(payload, d.err) {
+		wait := time.NewTimer(startupRequeueDelay)
+		waitStart := time.Now()
+		select {
+		case <-ctx.Done():
+			d.err = newNetworkError("context canceled during startup requeue", ctx.Err())
+		case <-wait.C:
 		}
-	}()
+		wait.Stop()
+		d.timing.retryDelay += time.Since(waitStart)
+		if ctx.Err() != nil {
+			break
+		}
+		m.attempt(ctx, d)
+	}
+	return m.finishDelivery(d)
+}
+
+// startDelivery records and encodes a payload and starts its shadow send. A
+// payload that cannot be encoded is returned with d.err set.
+func (m *Meter) startDelivery(ctx context.Context, payload *MeteringPayload) *delivery {
+	if m.otel != nil {
+		m.otel.record(ctx, payload)
+	}
+	m.events.SendStarted(payload)
+	d := &delivery{payload: payload, start: time.Now()}
+	d.body, d.correlationID, d.err = m.encodePayload(payload)
+	if d.err == nil {
+		m.startShadow(ctx, payload, d.body, d.correlationID)
+	}
+	return d
+}
+
+// attempt sends d with retries, counting a startup requeue as one more retry.
+func (m *Meter) attempt(ctx context.Context, d *delivery) {
+	retries, err := m.sendWithRetry(ctx, d.payload, d.body, d.correlationID, &d.timing)
+	if d.passes > 0 {
+		retries++
+	}
+	d.passes++
+	d.retries += retries
+	d.err = err
+}
+
+// finishDelivery records the outcome of d in the meter's stats, event sink,
+// and result channel, and returns its error.
+func (m *Meter) finishDelivery(d *delivery) error {
+	payload, err := d.payload, d.err
+	latency := time.Since(d.start)
+	m.stats.retryDelay.Add(int64(d.timing.retryDelay))
+	m.stats.requestTime.Add(int64(d.timing.requestTime))
+	if err != nil {
+		m.stats.failed.Add(1)
+		if errors.Is(err, errBreakerOpen) {
+			m.logger.Debug("circuit breaker open, payload not sent (%s)", payloadLogFields(payload))
+		} else {
+			m.logger.Error("failed to send metering payload (%s): %v", payloadLogFields(payload), err)
+		}
+		m.events.SendFailed(payload, d.retries, err)
+	} else {
+		m.stats.sent.Add(1)
+		m.stats.lastSuccess.Store(time.Now().UnixNano())
+		m.events.SendSucceeded(payload, d.retries, latency)
+	}
+	m.publishResult(SendResult{
+		Payload:     payload,
+		Err:         err,
+		Retries:     d.retries,
+		Latency:     latency,
+		RetryDelay:  d.timing.retryDelay,
+		RequestTime: d.timing.requestTime,
+	})
+	return err
+}
+
+// requeueOnStartup reports whether a failed payload should be re-queued
+// because it could not connect (e.g., DNS not yet resolvable) during the
+// WithStartupGrace window after NewMeter. Self-test payloads are never
+// re-queued so WithVerifyOnStart still fails fast, and neither are sends that
+// may already have been processed.
+func (m *Meter) requeueOnStartup(payload *MeteringPayload, err error) bool {
+	if m.cfg.StartupGrace <= 0 || payload.SelfTest || time.Since(m.startedAt) >= m.cfg.StartupGrace ||
+		errors.Is(err, errAmbiguousSend) {
+		return false
+	}
+	var dnsErr *net.DNSError
+	var opErr *net.OpError
+	if !errors.As(err, &dnsErr) && !errors.As(err, &opErr) {
+		return false
+	}
+	m.stats.requeued.Add(1)
+	m.logger.Debug("re-queuing payload after connection failure during startup grace (%s): %v",
+		payloadLogFields(payload), err)
+	return true
+}
+
+// SelfTest sends a synthetic completion payload synchronously through the
+// regular enrichment and retry path and returns the delivery error, if any.
+// The payload is flagged with selfTest=true so it can be filtered server-side.
+// Use it in deploy smoke tests to validate the full pipeline end to end.
+func (m *Meter) SelfTest(ctx context.Context) error {
+	now := time.Now().UTC().Format(iso8601)
+	payload := &MeteringPayload{
+		Model:               "revenium-self-test",
+		InputTokenCount:     1,
+		OutputTokenCount:    1,
+		TotalTokenCount:     2,
+		StopReason:          StopReasonEnd,
+		RequestTime:         now,
+		CompletionStartTime: now,
+		ResponseTime:        now,
+		Provider:            "revenium",
+		BillingUnit:         BillingUnitPerToken,
+		TransactionID:       m.newID(),
+		SelfTest:            true,
+	}
+	m.Enrich(ctx, payload)
+	m.events.PayloadBuilt(payload)
+	return m.deliver(ctx, payload)
 }
 
-// Flush waits for all pending async sends to complete.
+// Warmup opens a keep-alive connection to the metering host by issuing a HEAD
+// request, so the next send skips the TCP and TLS handshake. Call it at startup
+// or after known idle periods; it is safe to call repeatedly. Any HTTP
+// response counts as success, since only the connection matters. It is a
+// no-op when a custom Transport is configured.
+func (m *Meter) Warmup(ctx context.Context) error {
+	if m.cfg.Transport != nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, sendTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, m.cfg.BaseURL+meteringPath, nil)
+	if err != nil {
+		return newNetworkError("failed to create warmup request", err)
+	}
+	req.Header.Set("User-Agent", m.userAgent)
+	resp, err := m.httpClient.Load().Do(req)
+	if err != nil {
+		return newNetworkError("warmup request failed", err)
+	}
+	// Drain the body so the connection returns to the idle pool.
+	_, _ = io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	m.logger.Debug("warmed up connection to %s (%d)", m.cfg.BaseURL, resp.StatusCode)
+	return nil
+}
+
+// Flush waits for all pending async sends to complete, including retries,
+// startup requeues, shadow sends, and sends started while it waits. SendAsync
+// registers each send before returning, so a test can call Flush once the
+// code under test returns and then assert on an httptest server, the result
+// channel, or Stats without resorting to time.Sleep.
 func (m *Meter) Flush() {
 	m.wg.Wait()
 }
 
-func (m *Meter) sendWithRetry(ctx context.Context, payload *MeteringPayload) error {
+// FlushAsync returns a channel that is closed once all pending async sends
+// have completed, so shutdown code can select on it alongside other steps
+// instead of blocking in Flush. Sends started after the call may also be
+// waited for.
+func (m *Meter) FlushAsync() <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		m.wg.Wait()
+		close(done)
+	}()
+	return done
+}
+
+// FlushContext waits for all pending async sends to complete, or until ctx is
+// done. In that case it returns an error wrapping ctx.Err() that reports how
+// many sends were still in flight. Those sends keep running to their own
+// timeout unless WithCancellableShutdown is enabled, in which case they are
+// canceled.
+func (m *Meter) FlushContext(ctx context.Context) error {
+	select {
+	case <-m.FlushAsync():
+		return nil
+	case <-ctx.Done():
+		remaining := m.inFlight.Load()
+		if m.cfg.CancellableShutdown {
+			m.abortSends()
+		}
+		return newMeteringError(fmt.Sprintf("flush stopped with %d sends in flight", remaining), ctx.Err())
+	}
+}
+
+// Close stops the meter from accepting new payloads and waits for pending sends
+// like FlushContext. Payloads passed to SendAsync after Close are dropped
+// without being enriched and counted in Stats().ShutdownDropped, so no work is
+// queued that could never drain. Close is safe to call more than once.
+func (m *Meter) Close(ctx context.Context) error {
+	m.closeMu.Lock()
+	m.closed = true
+	m.closeMu.Unlock()
+	err := m.FlushContext(ctx)
+	// Stop the workers even when the flush timed out; they exit once the
+	// queued jobs have run, and later dispatches are dropped.
+	if m.queue != nil {
+		m.stopWorkers()
+	}
+	return err
+}
+
+// begin registers a pending send, reporting false once the meter is closed.
+func (m *Meter) begin() bool {
+	m.closeMu.RLock()
+	defer m.closeMu.RUnlock()
+	if m.closed {
+		return false
+	}
+	m.wg.Add(1)
+	m.inFlight.Add(1)
+	return true
+}
+
+// end marks a send registered by begin as finished.
+func (m *Meter) end() {
+	m.inFlight.Add(-1)
+	m.wg.Done()
+}
+
+// abortContext returns the context whose cancellation aborts the sends
+// currently in flight under WithCancellableShutdown.
+func (m *Meter) abortContext() context.Context {
+	m.abortMu.Lock()
+	defer m.abortMu.Unlock()
+	if m.abortCtx == nil {
+		m.abortCtx, m.abortCancel = context.WithCancel(context.Background())
+	}
+	return m.abortCtx
+}
+
+// abortSends cancels the sends currently in flight. Sends started afterwards
+// are unaffected.
+func (m *Meter) abortSends() {
+	m.abortMu.Lock()
+	defer m.abortMu.Unlock()
+	if m.abortCancel != nil {
+		m.abortCancel()
+		m.abortCtx, m.abortCancel = nil, nil
+	}
+}
+
+// sendTiming splits the time spent delivering a payload between backoff
+// waits and the requests themselves.
+type sendTiming struct {
+	retryDelay  time.Duration
+	requestTime time.Duration
+}
+
+// encodePayload validates and marshals a payload for sending, applying the
+// subscriber checks, field allowlist, and size limit, and picks its
+// correlation ID. It runs once per payload, however often the send is
+// retried or re-queued.
+func (m *Meter) encodePayload(payload *MeteringPayload) ([]byte, string, error) {
+	if err := payload.validate(); err != nil {
+		m.events.PayloadDropped(payload, err)
+		return nil, "", err
+	}
+
+	if m.cfg.SubscriberValidation {
+		m.checkSubscribers(payload)
+	}
+	if m.allowlist != nil {
+		applyFieldAllowlist(payload, m.allowlist)
+	}
+
 	body, err := json.Marshal(payload)
 	if err != nil {
-		return newMeteringError("failed to marshal payload", err)
+		return nil, "", newMeteringError("failed to marshal payload", err)
+	}
+	if body, err = m.enforceMaxBodyBytes(payload, body); err != nil {
+		m.events.PayloadDropped(payload, err)
+		return nil, "", err
 	}
 
 	m.logger.Debug("metering payload: %s", string(body))
+	m.writeDebug(body)
 
-	url := m.cfg.BaseURL + meteringPath
-	backoff := time.Second
+	var correlationID string
+	if m.cfg.CorrelationHeader != "" {
+		correlationID = payload.TransactionID
+		if correlationID == "" {
+			correlationID = m.newID()
+		}
+	}
+	return body, correlationID, nil
+}
 
-	const maxRetries = 3
-	for attempt := 0; attempt <= maxRetries; attempt++ {
+// sendWithRetry delivers a payload, retrying with backoff. It returns the number
+// of retries performed and the final error, if any, and adds the time spent
+// waiting and sending to timing.
+func (m *Meter) sendWithRetry(ctx context.Context, payload *MeteringPayload, body []byte, correlationID string, timing *sendTiming) (int, error) {
+	url := m.cfg.BaseURL + meteringPath
+	backoff := retryBaseBackoff
+	var delay time.Duration
+	var err error
+	for attempt := 0; ; attempt++ {
 		if attempt > 0 {
-			m.logger.Debug("retrying metering request (attempt %d/%d)", attempt, maxRetries)
+			m.logger.Debug("retrying metering request (retry %d, after %s)", attempt, delay)
+			m.events.SendRetried(payload, attempt, err)
+			waitStart := time.Now()
 			select {
 			case <-ctx.Done():
-				return newNetworkError("context canceled during retry", ctx.Err())
-			case <-time.After(backoff):
+				timing.retryDelay += time.Since(waitStart)
+				return attempt - 1, newNetworkError("context canceled during retry", ctx.Err())
+			case <-time.After(delay):
 			}
-			backoff *= 2
+			timing.retryDelay += time.Since(waitStart)
 		}
 
-		err = m.send(ctx, url, body)
+		if m.breaker != nil && !m.breaker.allow() {
+			m.stats.breakerReject.Add(1)
+			err = newNetworkError("dropping payload", errBreakerOpen)
+			m.events.PayloadDropped(payload, err)
+			return attempt, err
+		}
+		reqStart := time.Now()
+		var resp *http.Response
+		if m.cfg.Transport != nil {
+			err = m.cfg.Transport.Send(ctx, payload, body)
+		} else {
+			resp, err = m.send(ctx, url, m.cfg.APIKey, body, correlationID)
+		}
+		timing.requestTime += time.Since(reqStart)
+		m.recordBreaker(err == nil)
 		if err == nil {
 			m.logger.Debug("metering payload sent successfully (model=%s, tokens=%d+%d)",
 				payload.Model, payload.InputTokenCount, payload.OutputTokenCount)
-			return nil
+			return attempt, nil
+		}
+		m.logger.Warn("metering request failed (attempt %d, %s): %v",
+			attempt+1, payloadLogFields(payload), err)
+		if m.cfg.RetryDecider != nil {
+			var retry bool
+			if retry, delay = m.cfg.RetryDecider(resp, err, attempt+1); !retry || attempt >= maxRetries {
+				return attempt, err
+			}
+			delay = max(delay, retryBaseBackoff)
+			continue
 		}
-		m.logger.Warn("metering request failed (attempt %d/%d): %v", attempt+1, maxRetries+1, err)
+		if errors.Is(err, errAmbiguousSend) {
+			if m.cfg.DisableAmbiguousRetry {
+				m.logger.Warn("not retrying metering request that may have been processed (%s)", payloadLogFields(payload))
+				return attempt, err
+			}
+			if attempt < maxRetries {
+				m.logger.Warn("retrying metering request that may have been processed; this can double-bill (%s)",
+					payloadLogFields(payload))
+			}
+		}
+		if attempt >= maxRetries {
+			return attempt, err
+		}
+		delay = backoff
+		backoff *= 2
+	}
+}
+
+// enforceMaxBodyBytes applies the WithMaxBodyBytes limit to a marshaled
+// payload, returning the body to send or an error when the payload is dropped.
+func (m *Meter) enforceMaxBodyBytes(payload *MeteringPayload, body []byte) ([]byte, error) {
+	limit := m.cfg.MaxBodyBytes
+	if limit == 0 || len(body) <= limit {
+		return body, nil
+	}
+	size := len(body)
+	if m.cfg.OversizePolicy == OversizeTruncate {
+		payload.SystemPrompt = ""
+		payload.InputMessages = ""
+		payload.OutputResponse = ""
+		payload.RawUsage = nil
+		payload.PromptsTruncated = true
+		truncated, err := json.Marshal(payload)
+		if err != nil {
+			return nil, newMeteringError("failed to marshal payload", err)
+		}
+		if len(truncated) <= limit {
+			m.logger.Warn("payload of %d bytes exceeds limit of %d, dropped captured content (%s)",
+				size, limit, payloadLogFields(payload))
+			return truncated, nil
+		}
+		size = len(truncated)
+	}
+	m.stats.oversize.Add(1)
+	m.logger.Warn("dropping payload of %d bytes exceeding limit of %d (%s)", size, limit, payloadLogFields(payload))
+	return nil, newValidationError(fmt.Sprintf("payload of %d bytes exceeds limit of %d", size, limit), nil)
+}
+
+// recordBreaker reports a delivery attempt outcome to the circuit breaker, if
+// configured, and logs state transitions.
+func (m *Meter) recordBreaker(success bool) {
+	if m.breaker == nil {
+		return
+	}
+	switch m.breaker.record(success) {
+	case BreakerOpen:
+		m.logger.Warn("circuit breaker open after repeated failures, pausing sends for %s", m.cfg.BreakerCooldown)
+	case BreakerClosed:
+		m.logger.Info("circuit breaker closed, metering endpoint recovered")
+	}
+}
+
+// writeDebug writes a marshaled payload as a line to the configured debug writer.
+func (m *Meter) writeDebug(body []byte) {
+	if m.cfg.DebugWriter == nil {
+		return
+	}
+	line := make([]byte, 0, len(body)+1)
+	line = append(append(line, body...), '\n')
+	m.debugMu.Lock()
+	defer m.debugMu.Unlock()
+	if _, err := m.cfg.DebugWriter.Write(line); err != nil {
+		m.logger.Warn("failed to write payload to debug writer: %v", err)
 	}
-	return err
 }
 
-func (m *Meter) send(ctx context.Context, url string, body []byte) error {
+// startShadow mirrors a payload to the shadow endpoint in the background, once
+// per payload. The shadow send gets its own timeout so it is not cut short
+// when the primary send returns, and is registered and dispatched like other
+// sends, so Flush and Close wait for it and WithMaxConcurrency bounds it.
+func (m *Meter) startShadow(ctx context.Context, payload *MeteringPayload, body []byte, correlationID string) {
+	if m.cfg.ShadowBaseURL == "" || !m.begin() {
+		return
+	}
+	ctx = context.WithoutCancel(ctx)
+	m.dispatch(sendJob{
+		run: func() {
+			ctx, cancel := context.WithTimeout(ctx, sendTimeout)
+			defer cancel()
+			m.sendShadow(ctx, payload, body, correlationID)
+		},
+		drop: func(err error) {
+			defer m.end()
+			m.logger.Warn("shadow metering request dropped (%s): %v", payloadLogFields(payload), err)
+		},
+	})
+}
+
+// sendShadow mirrors an already-marshaled payload to the shadow endpoint. It
+// makes a single attempt and only logs failures; the primary send remains the
+// authoritative result.
+func (m *Meter) sendShadow(ctx context.Context, payload *MeteringPayload, body []byte, correlationID string) {
+	defer m.end()
+	defer m.recoverPanic("shadow metering send")
+	if _, err := m.send(ctx, m.cfg.ShadowBaseURL+meteringPath, m.cfg.ShadowAPIKey, body, correlationID); err != nil {
+		m.logger.Warn("shadow metering request failed (%s): %v", payloadLogFields(payload), err)
+		return
+	}
+	m.logger.Debug("shadow metering payload sent (%s)", payloadLogFields(payload))
+}
+
+// payloadLogFields returns the identifiers needed to correlate a log line with
+// a specific completion. Only IDs and the model name are included; captured
+// prompts and subscriber details are never logged. They are formatted lazily,
+// by the logger, so suppressed levels cost nothing.
+func payloadLogFields(payload *MeteringPayload) logFields {
+	return logFields{payload}
+}
+
+// logFields formats a payload's log identifiers when printed with %s.
+type logFields struct {
+	payload *MeteringPayload
+}
+
+func (f logFields) String() string {
+	return fmt.Sprintf("model=%s transaction=%s trace=%s",
+		f.payload.Model, f.payload.TransactionID, f.payload.TraceID)
+}
+
+// errAmbiguousSend marks a send that failed after the request body was fully
+// written, so the Revenium API may have recorded the payload.
+var errAmbiguousSend = errors.New("request sent but no response received")
+
+// send posts body to url. The response, if any, is returned alongside any
+// error, with its body already read and replaced by an in-memory copy.
+func (m *Meter) send(ctx context.Context, url, apiKey string, body []byte, correlationID string) (*http.Response, error) {
 	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
 	if err != nil {
-		return newNetworkError("failed to create request", err)
+		return nil, newNetworkError("failed to create request", err)
 	}
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("x-api-key", m.cfg.APIKey)
-	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set("x-api-key", apiKey)
+	req.Header.Set("User-Agent", m.userAgent)
+	if correlationID != "" {
+		req.Header.Set(m.cfg.CorrelationHeader, correlationID)
+	}
+	if m.cfg.Tenant != "" {
+		req.Header.Set(m.cfg.TenantHeader, m.cfg.Tenant)
+	}
+
+	// Track whether the full request was written, so a failure afterwards can
+	// be flagged as ambiguous: the server may have processed it.
+	var wrote atomic.Bool
+	req = req.WithContext(httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		WroteRequest: func(info httptrace.WroteRequestInfo) { wrote.Store(info.Err == nil) },
+	}))
 
-	resp, err := m.cfg.HTTPClient.Do(req)
+	resp, err := m.httpClient.Load().Do(req)
 	if err != nil {
-		return newNetworkError("request failed", err)
+		if wrote.Load() {
+			err = fmt.Errorf("%w: %w", errAmbiguousSend, err)
+		}
+		return nil, newNetworkError("request failed", err)
 	}
-	defer resp.Body.Close()
 	respBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
 	if err != nil {
 		m.logger.Warn("failed to read metering response body: %v", err)
 	}
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
 
 	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
-		return nil
+		return resp, nil
 	}
 	m.logger.Debug("metering API response (%d): %s", resp.StatusCode, string(respBody))
-	return newMeteringError(fmt.Sprintf("unexpected status code: %d", resp.StatusCode), nil)
+	return resp, newMeteringError(fmt.Sprintf("unexpected status code: %d", resp.StatusCode), nil)
 }
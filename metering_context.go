@@ -13,6 +13,9 @@ type MeteringContext struct {
 	// OrganizationName identifies the organization for this request.
 	OrganizationName string
 
+	// Environment is the deployment environment for this request.
+	Environment string
+
 	// SubscriptionID is the subscription identifier for this request.
 	SubscriptionID string
 
@@ -21,6 +24,12 @@ type MeteringContext struct {
 
 	// Subscriber holds subscriber metadata for this request.
 	Subscriber *SubscriberResource
+
+	// AdditionalSubscribers are secondary subscribers sharing this request.
+	AdditionalSubscribers []*SubscriberResource
+
+	// SubscriberSplit controls how usage is apportioned across subscribers.
+	SubscriberSplit string
 }
 
 // WithMeteringContext stores a MeteringContext in the context.
@@ -33,18 +42,48 @@ func WithMeteringContext(ctx context.Context, mc *MeteringContext) context.Conte
 	mcCopy := *mc
 	// Deep copy the Subscriber if present
 	if mc.Subscriber != nil {
-		subCopy := *mc.Subscriber
-		if mc.Subscriber.Credential != nil {
-			credCopy := *mc.Subscriber.Credential
-			subCopy.Credential = &credCopy
+		mcCopy.Subscriber = copySubscriber(mc.Subscriber)
+	}
+	if mc.AdditionalSubscribers != nil {
+		mcCopy.AdditionalSubscribers = make([]*SubscriberResource, len(mc.AdditionalSubscribers))
+		for i, sub := range mc.AdditionalSubscribers {
+			if sub != nil {
+				mcCopy.AdditionalSubscribers[i] = copySubscriber(sub)
+			}
 		}
-		mcCopy.Subscriber = &subCopy
 	}
 	return context.WithValue(ctx, meteringContextKey{}, &mcCopy)
 }
 
+// copySubscriber returns a deep copy of sub.
+func copySubscriber(sub *SubscriberResource) *SubscriberResource {
+	subCopy := *sub
+	if sub.Credential != nil {
+		credCopy := *sub.Credential
+		subCopy.Credential = &credCopy
+	}
+	return &subCopy
+}
+
 // GetMeteringContext retrieves the MeteringContext from the context, or nil if not set.
 func GetMeteringContext(ctx context.Context) *MeteringContext {
 	mc, _ := ctx.Value(meteringContextKey{}).(*MeteringContext)
 	return mc
 }
+
+// meteringContext returns the MeteringContext from ctx like GetMeteringContext,
+// but logs a warning, once per meter, when the context key holds a value of an
+// unexpected type instead of silently treating it as unset.
+func (m *Meter) meteringContext(ctx context.Context) *MeteringContext {
+	v := ctx.Value(meteringContextKey{})
+	if v == nil {
+		return nil
+	}
+	mc, ok := v.(*MeteringContext)
+	if !ok {
+		m.badMeteringCtx.Do(func() {
+			m.logger.Warn("ignoring metering context value of unexpected type %T", v)
+		})
+	}
+	return mc
+}
@@ -12,6 +12,14 @@ func WithOrganization(name string) MeteringContextOption {
 	}
 }
 
+// WithEnvironmentName sets the deployment environment on the MeteringContext.
+// It is named to avoid clashing with the Meter-level WithEnvironment option.
+func WithEnvironmentName(env string) MeteringContextOption {
+	return func(mc *MeteringContext) {
+		mc.Environment = env
+	}
+}
+
 // WithSubscription sets the subscription ID on the MeteringContext.
 func WithSubscription(id string) MeteringContextOption {
 	return func(mc *MeteringContext) {
@@ -47,6 +55,22 @@ func WithSubscriberCredentialInfo(name, value string) MeteringContextOption {
 	}
 }
 
+// WithAdditionalSubscriberInfo adds a secondary subscriber sharing the request
+// with the primary subscriber. It can be repeated.
+func WithAdditionalSubscriberInfo(id, email string) MeteringContextOption {
+	return func(mc *MeteringContext) {
+		mc.AdditionalSubscribers = append(mc.AdditionalSubscribers, &SubscriberResource{ID: id, Email: email})
+	}
+}
+
+// WithSubscriberSplitMode sets how usage is apportioned across the primary and
+// additional subscribers on the MeteringContext.
+func WithSubscriberSplitMode(split string) MeteringContextOption {
+	return func(mc *MeteringContext) {
+		mc.SubscriberSplit = split
+	}
+}
+
 // NewMeteringContext creates a new MeteringContext with the given options.
 func NewMeteringContext(opts ...MeteringContextOption) *MeteringContext {
 	mc := &MeteringContext{}
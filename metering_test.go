@@ -0,0 +1,376 @@
+package revenium
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingServer returns a server that answers every request with status and
+// counts the requests it receives.
+func countingServer(t *testing.T, status int) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		hits.Add(1)
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &hits
+}
+
+// testPayload returns a minimal payload that passes validation.
+func testPayload() *MeteringPayload {
+	return &MeteringPayload{
+		Model:           "test-model",
+		Provider:        "test",
+		BillingUnit:     BillingUnitPerToken,
+		StopReason:      StopReasonEnd,
+		InputTokenCount: 1,
+	}
+}
+
+func TestRetryDeciderStopsRetries(t *testing.T) {
+	srv, hits := countingServer(t, http.StatusServiceUnavailable)
+	var calls atomic.Int32
+	m, err := NewMeter(
+		WithAPIKey("hak_test"),
+		WithBaseURL(srv.URL),
+		WithRetryDecider(func(*http.Response, error, int) (bool, time.Duration) {
+			calls.Add(1)
+			return false, 0
+		}),
+	)
+	if err != nil {
+		t.Fatalf("NewMeter: %v", err)
+	}
+	defer m.Close(context.Background())
+
+	start := time.Now()
+	m.SendAsync(context.Background(), testPayload())
+	m.Flush()
+
+	if got := hits.Load(); got != 1 {
+		t.Errorf("server received %d requests, want 1", got)
+	}
+	if got := calls.Load(); got != 1 {
+		t.Errorf("decider called %d times, want 1", got)
+	}
+	if stats := m.Stats(); stats.Failed != 1 || stats.Sent != 0 {
+		t.Errorf("stats sent=%d failed=%d, want sent=0 failed=1", stats.Sent, stats.Failed)
+	}
+	// The built-in policy would have backed off for seconds before giving up.
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("send took %v, want no backoff", elapsed)
+	}
+}
+
+func TestRetryDeciderAlwaysRetryIsBounded(t *testing.T) {
+	t.Parallel()
+	srv, hits := countingServer(t, http.StatusServiceUnavailable)
+	m, err := NewMeter(
+		WithAPIKey("hak_test"),
+		WithBaseURL(srv.URL),
+		WithRetryDecider(func(*http.Response, error, int) (bool, time.Duration) {
+			return true, 0
+		}),
+	)
+	if err != nil {
+		t.Fatalf("NewMeter: %v", err)
+	}
+	defer m.Close(context.Background())
+
+	start := time.Now()
+	m.SendAsync(context.Background(), testPayload())
+	m.Flush()
+
+	if got := hits.Load(); got != maxRetries+1 {
+		t.Errorf("server received %d requests, want %d", got, maxRetries+1)
+	}
+	if elapsed, want := time.Since(start), maxRetries*retryBaseBackoff; elapsed < want {
+		t.Errorf("send took %v, want at least %v of clamped backoff", elapsed, want)
+	}
+}
+
+// panicTransport panics on every send.
+type panicTransport struct{}
+
+func (panicTransport) Send(context.Context, *MeteringPayload, []byte) error {
+	panic("transport failure")
+}
+
+// panicSink panics when a send starts.
+type panicSink struct{ NopEventSink }
+
+func (panicSink) SendStarted(*MeteringPayload) { panic("sink failure") }
+
+func TestSendPanicsAreContained(t *testing.T) {
+	srv, _ := countingServer(t, http.StatusServiceUnavailable)
+	panicDecider := WithRetryDecider(func(*http.Response, error, int) (bool, time.Duration) {
+		panic("decider failure")
+	})
+	tests := []struct {
+		name string
+		opts []Option
+	}{
+		{"transport", []Option{WithTransport(panicTransport{})}},
+		{"event sink", []Option{WithTransport(NewInMemoryStore()), WithEventSink(panicSink{})}},
+		{"retry decider", []Option{WithAPIKey("hak_test"), WithBaseURL(srv.URL), panicDecider}},
+		{"inline transport", []Option{WithTransport(panicTransport{}), WithInlineMeteringSpan(true)}},
+		{"pooled transport", []Option{WithTransport(panicTransport{}), WithMaxConcurrency(1)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := NewMeter(tt.opts...)
+			if err != nil {
+				t.Fatalf("NewMeter: %v", err)
+			}
+			defer m.Close(context.Background())
+
+			m.submit(context.Background(), testPayload())
+			m.Flush()
+
+			stats := m.Stats()
+			if stats.Panics != 1 {
+				t.Errorf("Panics = %d, want 1", stats.Panics)
+			}
+			if stats.InFlight != 0 {
+				t.Errorf("InFlight = %d, want 0", stats.InFlight)
+			}
+		})
+	}
+}
+
+// errTransport fails every send.
+type errTransport struct{}
+
+func (errTransport) Send(context.Context, *MeteringPayload, []byte) error {
+	return newNetworkError("unavailable", nil)
+}
+
+func TestTrySendBreakerRejectCountsFailed(t *testing.T) {
+	m, err := NewMeter(
+		WithTransport(errTransport{}),
+		WithCircuitBreaker(1, time.Hour),
+		WithRetryDecider(func(*http.Response, error, int) (bool, time.Duration) { return false, 0 }),
+	)
+	if err != nil {
+		t.Fatalf("NewMeter: %v", err)
+	}
+	defer m.Close(context.Background())
+
+	if !m.TrySend(context.Background(), testPayload()) {
+		t.Fatal("TrySend rejected the first payload")
+	}
+	m.Flush()
+	if m.TrySend(context.Background(), testPayload()) {
+		t.Fatal("TrySend accepted a payload with the breaker open")
+	}
+
+	stats := m.Stats()
+	if stats.BreakerRejected != 1 {
+		t.Errorf("BreakerRejected = %d, want 1", stats.BreakerRejected)
+	}
+	if stats.Failed != 2 {
+		t.Errorf("Failed = %d, want 2", stats.Failed)
+	}
+}
+
+// blockingTransport blocks each send until its context is done.
+type blockingTransport struct {
+	started chan struct{}
+}
+
+func (b *blockingTransport) Send(ctx context.Context, _ *MeteringPayload, _ []byte) error {
+	b.started <- struct{}{}
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestCancellableShutdownAbortsInlineSend(t *testing.T) {
+	transport := &blockingTransport{started: make(chan struct{}, 1)}
+	m, err := NewMeter(
+		WithTransport(transport),
+		WithInlineMeteringSpan(true),
+		WithCancellableShutdown(true),
+		WithRetryDecider(func(*http.Response, error, int) (bool, time.Duration) { return false, 0 }),
+	)
+	if err != nil {
+		t.Fatalf("NewMeter: %v", err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		m.submit(context.Background(), testPayload())
+	}()
+	<-transport.started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := m.Close(ctx); err == nil {
+		t.Error("Close returned nil, want a timeout error")
+	}
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("inline send was not aborted by Close")
+	}
+	if stats := m.Stats(); stats.Failed != 1 || stats.InFlight != 0 {
+		t.Errorf("stats failed=%d inFlight=%d, want failed=1 inFlight=0", stats.Failed, stats.InFlight)
+	}
+}
+
+// flakyTransport fails its next failures sends with a connection error, then
+// records the model of each payload it delivers, in order.
+type flakyTransport struct {
+	mu       sync.Mutex
+	failures int
+	sent     []string
+}
+
+func (f *flakyTransport) Send(_ context.Context, payload *MeteringPayload, _ []byte) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.failures > 0 {
+		f.failures--
+		return &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+	}
+	f.sent = append(f.sent, payload.Model)
+	return nil
+}
+
+func TestStartupRequeueReleasesWorker(t *testing.T) {
+	transport := &flakyTransport{failures: 1}
+	m, err := NewMeter(
+		WithTransport(transport),
+		WithStartupGrace(time.Minute),
+		WithMaxConcurrency(1),
+		WithRetryDecider(func(*http.Response, error, int) (bool, time.Duration) { return false, 0 }),
+	)
+	if err != nil {
+		t.Fatalf("NewMeter: %v", err)
+	}
+	defer m.Close(context.Background())
+
+	first, second := testPayload(), testPayload()
+	first.Model, second.Model = "first", "second"
+	m.SendAsync(context.Background(), first)
+	time.Sleep(100 * time.Millisecond)
+	m.SendAsync(context.Background(), second)
+	m.Flush()
+
+	// The requeued payload waits off the worker, so the second payload is
+	// delivered before it.
+	if got := strings.Join(transport.sent, ","); got != "second,first" {
+		t.Errorf("delivery order = %s, want second,first", got)
+	}
+	stats := m.Stats()
+	if stats.Requeued != 1 || stats.Sent != 2 || stats.Failed != 0 {
+		t.Errorf("stats requeued=%d sent=%d failed=%d, want 1, 2, 0", stats.Requeued, stats.Sent, stats.Failed)
+	}
+}
+
+func TestSampleRateZeroDropsAll(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []Option
+		env  string
+		want int
+	}{
+		{"default", nil, "prod", 5},
+		{"global zero", []Option{WithSampleRate(0)}, "prod", 0},
+		{"environment zero", []Option{WithSampleRates(map[string]float64{"dev": 0})}, "dev", 0},
+		{"environment overrides global zero", []Option{WithSampleRate(0), WithSampleRates(map[string]float64{"dev": 1})}, "dev", 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, store := newTestMeter(t, tt.opts...)
+			for range 5 {
+				payload := testPayload()
+				payload.Environment = tt.env
+				m.SendAsync(context.Background(), payload)
+			}
+			m.Flush()
+			if got := store.Len(); got != tt.want {
+				t.Errorf("sent %d payloads, want %d", got, tt.want)
+			}
+			if got := m.Stats().SampledOut; got != uint64(5-tt.want) {
+				t.Errorf("SampledOut = %d, want %d", got, 5-tt.want)
+			}
+		})
+	}
+}
+
+func TestBreakerRejectionIsQuiet(t *testing.T) {
+	m, err := NewMeter(
+		WithTransport(errTransport{}),
+		WithCircuitBreaker(1, time.Hour),
+		WithResultChannel(4),
+		WithRetryDecider(func(*http.Response, error, int) (bool, time.Duration) { return false, 0 }),
+	)
+	if err != nil {
+		t.Fatalf("NewMeter: %v", err)
+	}
+	defer m.Close(context.Background())
+
+	// The first failure opens the breaker.
+	m.SendAsync(context.Background(), testPayload())
+	m.Flush()
+	<-m.Results()
+
+	buf := captureLog(t)
+	m.SendAsync(context.Background(), testPayload())
+	m.Flush()
+	result := <-m.Results()
+
+	if !errors.Is(result.Err, errBreakerOpen) {
+		t.Errorf("result error = %v, want errBreakerOpen", result.Err)
+	}
+	if result.Retries != 0 {
+		t.Errorf("Retries = %d, want 0", result.Retries)
+	}
+	if strings.Contains(buf.String(), "[revenium:error]") {
+		t.Errorf("breaker rejection logged an error:\n%s", buf.String())
+	}
+	if stats := m.Stats(); stats.BreakerRejected != 1 {
+		t.Errorf("BreakerRejected = %d, want 1", stats.BreakerRejected)
+	}
+}
+
+func TestPayloadLogFieldsFormatsLazily(t *testing.T) {
+	payload := testPayload()
+	fields := payloadLogFields(payload)
+	payload.TransactionID, payload.TraceID = "txn-1", "trace-1"
+	if got, want := fmt.Sprint(fields), "model=test-model transaction=txn-1 trace=trace-1"; got != want {
+		t.Errorf("payloadLogFields = %q, want %q", got, want)
+	}
+}
+
+func TestFlushWaitsForEarlierSends(t *testing.T) {
+	srv, hits := countingServer(t, http.StatusOK)
+	m, err := NewMeter(WithAPIKey("hak_test"), WithBaseURL(srv.URL))
+	if err != nil {
+		t.Fatalf("NewMeter: %v", err)
+	}
+	defer m.Close(context.Background())
+
+	for range 20 {
+		m.SendAsync(context.Background(), testPayload())
+	}
+	m.Flush()
+	if got := hits.Load(); got != 20 {
+		t.Errorf("server received %d requests after Flush, want 20", got)
+	}
+	if stats := m.Stats(); stats.Sent != 20 || stats.InFlight != 0 {
+		t.Errorf("stats sent=%d inFlight=%d, want 20, 0", stats.Sent, stats.InFlight)
+	}
+}
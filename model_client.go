@@ -3,8 +3,12 @@ package revenium
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"goa.design/goa-ai/runtime/agent/model"
 )
@@ -17,6 +21,7 @@ type meteringClient struct {
 	meter          *Meter
 	modelID        string
 	agentID        string
+	agentVersion   string
 	provider       string
 	capturePrompts bool
 }
@@ -25,56 +30,135 @@ func (c *meteringClient) Complete(ctx context.Context, req *model.Request) (*mod
 	start := time.Now()
 	resp, err := c.inner.Complete(ctx, req)
 	end := time.Now()
-	elapsed := end.Sub(start)
 
 	if err != nil {
-		return nil, err
+		// Some providers return a usable partial response alongside the error
+		// (e.g., a timeout after some output). Meter the usage already incurred.
+		if resp != nil && (resp.Usage.InputTokens > 0 || resp.Usage.OutputTokens > 0) {
+			payload := c.buildPayload(ctx, req, resp, start, end)
+			payload.StopReason = stopReasonForError(err)
+			payload.ProviderRequestID = providerRequestID(err, nil)
+			c.meter.submit(ctx, payload)
+		}
+		return resp, err
 	}
 
-	// squad := ResolveSquad(c.meter.cfg, c.agentID)
+	c.meter.submit(ctx, c.buildPayload(ctx, req, resp, start, end))
+	return resp, nil
+}
+
+// buildPayload builds the metering payload for a non-streaming completion.
+func (c *meteringClient) buildPayload(ctx context.Context, req *model.Request, resp *model.Response, start, end time.Time) *MeteringPayload {
+	squad := ResolveSquadContext(ctx, c.meter.cfg, c.agentID)
 	// Use model from response usage if available, otherwise fall back to request/config
 	modelName := resp.Usage.Model
 	if modelName == "" {
 		modelName = c.resolveModel(req)
 	}
 	payload := &MeteringPayload{
-		Model:               modelName,
-		InputTokenCount:     resp.Usage.InputTokens,
-		OutputTokenCount:    resp.Usage.OutputTokens,
-		TotalTokenCount:     resp.Usage.InputTokens + resp.Usage.OutputTokens,
-		StopReason:          MapStopReason(resp.StopReason),
-		RequestTime:         start.UTC().Format(iso8601),
-		CompletionStartTime: start.UTC().Format(iso8601),
-		ResponseTime:        end.UTC().Format(iso8601),
-		RequestDuration:     elapsed.Milliseconds(),
-		Provider:            c.provider,
-		IsStreamed:          false,
-		BillingUnit:         "PER_TOKEN",
-		Agent:               c.agentID,
-		// SquadID:             squad,
-		// SquadName:           squad,
+		Model:                   modelName,
+		InputTokenCount:         resp.Usage.InputTokens,
+		OutputTokenCount:        resp.Usage.OutputTokens,
+		TotalTokenCount:         c.meter.totalTokens(resp.Usage),
+		StopReason:              c.meter.mapStopReason(resp.StopReason),
+		RequestTime:             start.UTC().Format(iso8601),
+		CompletionStartTime:     start.UTC().Format(iso8601),
+		ResponseTime:            end.UTC().Format(iso8601),
+		RequestDuration:         end.Sub(start).Milliseconds(),
+		Provider:                c.provider,
+		IsStreamed:              false,
+		BillingUnit:             c.meter.billingUnit(ctx),
+		Agent:                   c.agentID,
+		AgentVersion:            c.agentVersion,
+		SquadID:                 squad,
+		SquadName:               squad,
 		CacheReadTokenCount:     resp.Usage.CacheReadTokens,
 		CacheCreationTokenCount: resp.Usage.CacheWriteTokens,
 	}
 
-	if tc := GetTraceContext(ctx); tc != nil {
-		payload.TraceID = tc.TraceID
-		payload.TraceName = tc.TraceName
-		payload.TraceType = tc.TraceType
-		payload.TransactionID = tc.TransactionID
-		payload.ParentTxnID = tc.ParentTxnID
-		// if tc.Squad != "" {
-		// 	payload.SquadID = tc.Squad
-		// 	payload.SquadName = tc.Squad
-		// }
+	applyTraceContext(payload, c.meter.traceContext(ctx))
+	c.meter.applyCacheTokenPolicy(payload)
+	setToolUsage(payload, countToolCalls(resp))
+	payload.CacheRequested = cacheRequested(req)
+	payload.ContentFiltered = isContentFiltered(resp.StopReason)
+	payload.InputChars = inputChars(req)
+	for i := range resp.Content {
+		payload.OutputChars += textChars(&resp.Content[i])
 	}
 
-	if c.capturePrompts {
-		populatePromptFields(payload, req, resp.Content)
+	if c.meter.cfg.CaptureRawUsage {
+		payload.RawUsage = c.meter.marshalRawUsage(resp.Usage, nil)
 	}
 
-	c.meter.SendAsync(ctx, payload)
-	return resp, nil
+	if c.meter.cfg.InputTokenBreakdown {
+		payload.InputTokenBreakdown = estimateInputTokenBreakdown(req, payload.InputTokenCount)
+	}
+
+	if scope := c.captureScope(ctx, payload.Model); scope != 0 {
+		populatePromptFields(payload, req, resp.Content, scope)
+	}
+
+	return payload
+}
+
+// totalTokens returns the totalTokenCount for usage according to the meter's
+// TotalTokenSource.
+func (m *Meter) totalTokens(usage model.TokenUsage) int {
+	if m.cfg.TotalTokenSource == TotalTokensFromProvider && usage.TotalTokens > 0 {
+		return usage.TotalTokens
+	}
+	return usage.InputTokens + usage.OutputTokens
+}
+
+// stopReasonForError classifies a completion error: deadline overruns map to
+// StopReasonTimeout and everything else to StopReasonError.
+func stopReasonForError(err error) string {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return StopReasonTimeout
+	}
+	return StopReasonError
+}
+
+// Streamer metadata keys that model adapters can set in model.Streamer's
+// Metadata to surface provider details goa-ai has no typed field for. The
+// adapters shipped with goa-ai do not set them; they are a contract for custom
+// adapters and wrappers. model.Response has no metadata, so they are only read
+// from streams.
+const (
+	// MetadataProviderRequestID holds the provider's request ID (e.g.,
+	// OpenAI's x-request-id) as a string. It is reported as
+	// providerRequestId. Failed calls also take it from a
+	// model.ProviderError, so non-streaming calls record it only on failure.
+	MetadataProviderRequestID = "request_id"
+	// MetadataProviderRetries holds the number of retries the provider SDK
+	// made before succeeding (e.g., after rate limiting), as an int, int64,
+	// or float64. It is reported as providerRetries.
+	MetadataProviderRetries = "retries"
+)
+
+// providerRequestID returns the provider's request ID from a provider error
+// or, failing that, from the MetadataProviderRequestID streamer metadata.
+func providerRequestID(err error, metadata map[string]any) string {
+	if pe, ok := model.AsProviderError(err); ok && pe.RequestID() != "" {
+		return pe.RequestID()
+	}
+	id, _ := metadata[MetadataProviderRequestID].(string)
+	return id
+}
+
+// providerRetries returns the MetadataProviderRetries count from streamer
+// metadata, or zero when it is absent or not a number.
+func providerRetries(metadata map[string]any) int {
+	switch v := metadata[MetadataProviderRetries].(type) {
+	case int:
+		return v
+	case int64:
+		return int(v)
+	case float64:
+		return int(v)
+	default:
+		return 0
+	}
 }
 
 // resolveModel returns the concrete model name from the request or falls back
@@ -92,33 +176,81 @@ func (c *meteringClient) Stream(ctx context.Context, req *model.Request) (model.
 	if err != nil {
 		return nil, err
 	}
+	modelID := c.resolveModel(req)
 	return &meteringStreamer{
-		inner:          streamer,
-		meter:          c.meter,
-		modelID:        c.resolveModel(req),
-		agentID:        c.agentID,
-		provider:       c.provider,
-		capturePrompts: c.capturePrompts,
-		req:            req,
-		start:          start,
-		ctx:            ctx,
+		inner:        streamer,
+		meter:        c.meter,
+		modelID:      modelID,
+		agentID:      c.agentID,
+		agentVersion: c.agentVersion,
+		provider:     c.provider,
+		captureScope: c.captureScope(ctx, modelID),
+		req:          req,
+		start:        start,
+		ctx:          ctx,
 	}, nil
 }
 
+// captureScope returns which prompt fields to capture for a call to modelName.
+// A per-call WithCaptureOutputOnly overrides everything else. Otherwise
+// WithCapturePromptsFor patterns decide first whether the model is captured at
+// all. Then an explicit WithCaptureScope on the meter takes precedence;
+// otherwise the planner's CapturePrompts flag captures everything or nothing.
+func (c *meteringClient) captureScope(ctx context.Context, modelName string) CaptureScope {
+	if captureOutputOnly(ctx) {
+		return CaptureOutputOnly
+	}
+	if patterns := c.meter.cfg.CapturePromptsFor; len(patterns) > 0 {
+		if !matchesAny(patterns, modelName) {
+			return 0
+		}
+		if c.meter.cfg.CaptureScope != 0 {
+			return c.meter.cfg.CaptureScope
+		}
+		return CaptureAll
+	}
+	if c.meter.cfg.CaptureScope != 0 {
+		return c.meter.cfg.CaptureScope
+	}
+	if c.capturePrompts {
+		return CaptureAll
+	}
+	return 0
+}
+
+// matchesAny reports whether name matches one of the path.Match patterns.
+func matchesAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
 // meteringStreamer wraps a model.Streamer to capture usage on close.
 type meteringStreamer struct {
-	inner          model.Streamer
-	meter          *Meter
-	modelID        string
-	agentID        string
-	provider       string
-	capturePrompts bool
-	req            *model.Request
-	start          time.Time
-	ctx            context.Context
-	usage          model.TokenUsage
-	stopReason     string
-	responseText   strings.Builder
+	inner        model.Streamer
+	meter        *Meter
+	modelID      string
+	agentID      string
+	agentVersion string
+	provider     string
+	captureScope CaptureScope
+	req          *model.Request
+	start        time.Time
+	ctx          context.Context
+	usage        model.TokenUsage
+	stopReason   string
+	toolCalls    int
+	ended        bool  // Recv returned an error, including io.EOF
+	closed       bool  // Close has metered the stream
+	recvErr      error // last non-nil error from Recv
+	firstChunk   time.Time
+	firstVisible time.Time
+	firstThought time.Time
+	responseText strings.Builder
+	outputChars  int
 }
 
 func (s *meteringStreamer) Recv() (model.Chunk, error) {
@@ -135,62 +267,142 @@ func (s *meteringStreamer) Recv() (model.Chunk, error) {
 	if chunk.StopReason != "" {
 		s.stopReason = chunk.StopReason
 	}
-	if s.capturePrompts && chunk.Message != nil {
+	if err != nil {
+		s.ended = true
+		s.recvErr = err
+	}
+	if err == nil {
+		s.markFirstChunk(chunk)
+	}
+	if chunk.ToolCall != nil {
+		s.toolCalls++
+	}
+	if chunk.Message != nil {
+		s.outputChars += textChars(chunk.Message)
+	}
+	if s.captureScope&CaptureOutputOnly != 0 && chunk.Message != nil {
 		s.responseText.WriteString(extractMessageText(chunk.Message))
 	}
 	return chunk, err
 }
 
+// markFirstChunk records when the first chunk of each kind arrived.
+func (s *meteringStreamer) markFirstChunk(chunk model.Chunk) {
+	now := time.Now()
+	if s.firstChunk.IsZero() {
+		s.firstChunk = now
+	}
+	switch {
+	case chunk.Type == model.ChunkTypeThinking || chunk.Thinking != "":
+		if s.firstThought.IsZero() {
+			s.firstThought = now
+		}
+	case chunk.Type == model.ChunkTypeText, chunk.Type == model.ChunkTypeToolCall, chunk.Type == model.ChunkTypeToolCallDelta:
+		if s.firstVisible.IsZero() {
+			s.firstVisible = now
+		}
+	}
+}
+
+// completionStart returns the completion start time selected by the meter's
+// CompletionStartMode, falling back to the request start time.
+func (s *meteringStreamer) completionStart() time.Time {
+	var t time.Time
+	switch s.meter.cfg.CompletionStartMode {
+	case CompletionStartFirstChunk:
+		t = s.firstChunk
+	case CompletionStartFirstReasoningToken:
+		t = s.firstThought
+		if t.IsZero() {
+			t = s.firstVisible
+		}
+	default:
+		t = s.firstVisible
+	}
+	if t.IsZero() {
+		return s.start
+	}
+	return t
+}
+
+// Close closes the inner stream and meters it. Only the first call meters, so
+// a deferred Close after an explicit one does not bill the stream twice. A
+// stream closed before it ended is metered with abandoned set, even when no
+// usage arrived.
 func (s *meteringStreamer) Close() error {
 	err := s.inner.Close()
+	if s.closed {
+		return err
+	}
+	s.closed = true
 	end := time.Now()
 	elapsed := end.Sub(s.start)
+	// A stream closed before a stop reason or end of stream was seen was
+	// abandoned by the consumer (e.g., the user navigated away). It is metered
+	// even when no usage was reported yet, so abandonment is always visible.
+	abandoned := s.stopReason == "" && !s.ended
 
-	if s.usage.InputTokens > 0 || s.usage.OutputTokens > 0 {
-		// squad := ResolveSquad(s.meter.cfg, s.agentID)
+	if s.usage.InputTokens > 0 || s.usage.OutputTokens > 0 || abandoned {
+		squad := ResolveSquadContext(s.ctx, s.meter.cfg, s.agentID)
 		// Use model from usage if available, otherwise fall back to configured model ID
 		modelName := s.usage.Model
 		if modelName == "" {
 			modelName = s.modelID
 		}
 		payload := &MeteringPayload{
-			Model:               modelName,
-			InputTokenCount:     s.usage.InputTokens,
-			OutputTokenCount:    s.usage.OutputTokens,
-			TotalTokenCount:     s.usage.InputTokens + s.usage.OutputTokens,
-			StopReason:          MapStopReason(s.stopReason),
-			RequestTime:         s.start.UTC().Format(iso8601),
-			CompletionStartTime: s.start.UTC().Format(iso8601),
-			ResponseTime:        end.UTC().Format(iso8601),
-			RequestDuration:     elapsed.Milliseconds(),
-			Provider:            s.provider,
-			IsStreamed:          true,
-			BillingUnit:         "PER_TOKEN",
-			Agent:               s.agentID,
-			// SquadID:             squad,
-			// SquadName:           squad,
+			Model:                   modelName,
+			InputTokenCount:         s.usage.InputTokens,
+			OutputTokenCount:        s.usage.OutputTokens,
+			TotalTokenCount:         s.meter.totalTokens(s.usage),
+			StopReason:              s.meter.mapStopReason(s.stopReason),
+			RequestTime:             s.start.UTC().Format(iso8601),
+			CompletionStartTime:     s.completionStart().UTC().Format(iso8601),
+			ResponseTime:            end.UTC().Format(iso8601),
+			RequestDuration:         elapsed.Milliseconds(),
+			Provider:                s.provider,
+			IsStreamed:              true,
+			BillingUnit:             s.meter.billingUnit(s.ctx),
+			Agent:                   s.agentID,
+			AgentVersion:            s.agentVersion,
+			SquadID:                 squad,
+			SquadName:               squad,
 			CacheReadTokenCount:     s.usage.CacheReadTokens,
 			CacheCreationTokenCount: s.usage.CacheWriteTokens,
 		}
 
-		if tc := GetTraceContext(s.ctx); tc != nil {
-			payload.TraceID = tc.TraceID
-			payload.TraceName = tc.TraceName
-			payload.TraceType = tc.TraceType
-			payload.TransactionID = tc.TransactionID
-			payload.ParentTxnID = tc.ParentTxnID
-			// if tc.Squad != "" {
-			// 	payload.SquadID = tc.Squad
-			// 	payload.SquadName = tc.Squad
-			// }
+		metadata := s.inner.Metadata()
+		payload.ProviderRequestID = providerRequestID(s.recvErr, metadata)
+		payload.ProviderRetries = providerRetries(metadata)
+
+		if abandoned {
+			payload.Abandoned = true
+			payload.StopReason = StopReasonCancelled
 		}
 
-		if s.capturePrompts {
-			populatePromptFields(payload, s.req, nil)
-			payload.OutputResponse = s.responseText.String()
+		applyTraceContext(payload, s.meter.traceContext(s.ctx))
+		s.meter.applyCacheTokenPolicy(payload)
+		setToolUsage(payload, s.toolCalls)
+		payload.CacheRequested = cacheRequested(s.req)
+		payload.ContentFiltered = isContentFiltered(s.stopReason)
+		payload.InputChars = inputChars(s.req)
+		payload.OutputChars = s.outputChars
+
+		if s.meter.cfg.CaptureRawUsage {
+			payload.RawUsage = s.meter.marshalRawUsage(s.usage, s.inner.Metadata())
 		}
 
-		s.meter.SendAsync(s.ctx, payload)
+		if s.meter.cfg.InputTokenBreakdown {
+			payload.InputTokenBreakdown = estimateInputTokenBreakdown(s.req, payload.InputTokenCount)
+		}
+
+		if s.captureScope != 0 {
+			populatePromptFields(payload, s.req, nil, s.captureScope)
+			if s.captureScope&CaptureOutputOnly != 0 {
+				payload.OutputResponse = s.responseText.String()
+			}
+		}
+
+		s.meter.submit(s.ctx, payload)
 	}
 
 	return err
@@ -200,6 +412,95 @@ func (s *meteringStreamer) Metadata() map[string]any {
 	return s.inner.Metadata()
 }
 
+// applyTraceContext copies trace correlation fields onto the payload.
+func applyTraceContext(payload *MeteringPayload, tc *TraceContext) {
+	if tc == nil {
+		return
+	}
+	payload.TraceID = tc.TraceID
+	payload.TraceName = tc.TraceName
+	payload.TraceType = tc.TraceType
+	payload.TransactionID = tc.TransactionID
+	payload.ParentTxnID = tc.ParentTxnID
+	payload.PlanPhase = tc.PlanPhase
+	payload.Step = tc.Step
+	if tc.Squad != "" {
+		payload.SquadID = tc.Squad
+		payload.SquadName = tc.Squad
+	}
+}
+
+// cacheRequested reports whether req asks the provider for prompt caching,
+// through request-level cache options or a cache checkpoint in a message.
+func cacheRequested(req *model.Request) bool {
+	if req == nil {
+		return false
+	}
+	if req.Cache != nil && (req.Cache.AfterSystem || req.Cache.AfterTools) {
+		return true
+	}
+	for _, msg := range req.Messages {
+		if msg == nil {
+			continue
+		}
+		for _, p := range msg.Parts {
+			if _, ok := p.(model.CacheCheckpointPart); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// countToolCalls returns the number of tool invocations requested in a response.
+// Adapters report them in ToolCalls, in the content as ToolUseParts, or both, so
+// ToolCalls is preferred and content parts are only counted as a fallback.
+func countToolCalls(resp *model.Response) int {
+	if len(resp.ToolCalls) > 0 {
+		return len(resp.ToolCalls)
+	}
+	n := 0
+	for _, msg := range resp.Content {
+		for _, p := range msg.Parts {
+			if _, ok := p.(model.ToolUsePart); ok {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+// setToolUsage records whether the model requested tool calls.
+func setToolUsage(payload *MeteringPayload, toolCalls int) {
+	payload.UsedTools = toolCalls > 0
+	payload.ToolCallCount = toolCalls
+}
+
+// applyCacheTokenPolicy clears cache token counts when cache reporting is disabled.
+func (m *Meter) applyCacheTokenPolicy(payload *MeteringPayload) {
+	if m.cfg.DisableCacheTokens {
+		payload.CacheReadTokenCount = 0
+		payload.CacheCreationTokenCount = 0
+	}
+}
+
+// rawUsage is the JSON shape of the rawUsage payload field.
+type rawUsage struct {
+	Usage    model.TokenUsage `json:"usage"`
+	Metadata map[string]any   `json:"metadata,omitempty"`
+}
+
+// marshalRawUsage serializes provider usage and metadata for the rawUsage
+// field. It returns nil when the data cannot be encoded.
+func (m *Meter) marshalRawUsage(usage model.TokenUsage, metadata map[string]any) json.RawMessage {
+	data, err := json.Marshal(rawUsage{Usage: usage, Metadata: metadata})
+	if err != nil {
+		m.logger.Debug("failed to marshal raw usage: %v", err)
+		return nil
+	}
+	return data
+}
+
 // extractMessageText returns the concatenated text content of a message.
 func extractMessageText(msg *model.Message) string {
 	var b strings.Builder
@@ -211,6 +512,121 @@ func extractMessageText(msg *model.Message) string {
 	return b.String()
 }
 
+// textChars returns the number of characters (runes) in a message's text.
+func textChars(msg *model.Message) int {
+	n := 0
+	for _, p := range msg.Parts {
+		if tp, ok := p.(model.TextPart); ok {
+			n += utf8.RuneCountInString(tp.Text)
+		}
+	}
+	return n
+}
+
+// inputChars returns the number of text characters in req's messages. Like
+// the token counts, it covers the system prompt and the whole conversation.
+func inputChars(req *model.Request) int {
+	if req == nil {
+		return 0
+	}
+	n := 0
+	for _, msg := range req.Messages {
+		if msg != nil {
+			n += textChars(msg)
+		}
+	}
+	return n
+}
+
+// captureMessageText returns the content of a message for prompt capture.
+// Text is included verbatim, followed by a placeholder for each image or
+// document part (e.g., "[image: image/png, 2048 bytes]") so captures reflect
+// that multimodal content was sent without embedding the raw bytes.
+func captureMessageText(msg *model.Message) string {
+	var lines []string
+	if text := extractMessageText(msg); text != "" {
+		lines = append(lines, text)
+	}
+	for _, p := range msg.Parts {
+		switch part := p.(type) {
+		case model.ImagePart:
+			lines = append(lines, fmt.Sprintf("[image: image/%s, %d bytes]", part.Format, len(part.Bytes)))
+		case model.DocumentPart:
+			if len(part.Bytes) > 0 {
+				lines = append(lines, fmt.Sprintf("[document: %s, %d bytes]", part.Format, len(part.Bytes)))
+			} else {
+				lines = append(lines, fmt.Sprintf("[document: %s]", part.Format))
+			}
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// breakdownRoleTool is the inputTokenBreakdown key for tool results, which
+// are sent in user messages but counted separately from user text. Other keys
+// are the conversation roles ("system", "user", "assistant").
+const breakdownRoleTool = "tool"
+
+// estimateInputTokenBreakdown apportions inputTokens across message roles in
+// proportion to the characters each role contributed to req. The shares always
+// sum to inputTokens; any rounding remainder goes to the largest role. It
+// returns nil when there is nothing to apportion.
+func estimateInputTokenBreakdown(req *model.Request, inputTokens int) map[string]int {
+	if req == nil || inputTokens <= 0 {
+		return nil
+	}
+	chars := make(map[string]int)
+	total := 0
+	for _, msg := range req.Messages {
+		if msg == nil {
+			continue
+		}
+		for _, p := range msg.Parts {
+			role, n := string(msg.Role), 0
+			switch part := p.(type) {
+			case model.TextPart:
+				n = len(part.Text)
+			case model.ToolUsePart:
+				n = jsonLen(part.Input)
+			case model.ToolResultPart:
+				role, n = breakdownRoleTool, jsonLen(part.Content)
+			}
+			if n > 0 {
+				chars[role] += n
+				total += n
+			}
+		}
+	}
+	if total == 0 {
+		return nil
+	}
+
+	breakdown := make(map[string]int, len(chars))
+	assigned, largest := 0, ""
+	for role, n := range chars {
+		breakdown[role] = inputTokens * n / total
+		assigned += breakdown[role]
+		if largest == "" || n > chars[largest] || (n == chars[largest] && role < largest) {
+			largest = role
+		}
+	}
+	breakdown[largest] += inputTokens - assigned
+	return breakdown
+}
+
+// jsonLen returns the length of v's JSON encoding, or of v itself when it is
+// a string.
+func jsonLen(v any) int {
+	if s, ok := v.(string); ok {
+		return len(s)
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return 0
+	}
+	return len(data)
+}
+
 // inputMessage is a simplified representation of a conversation message
 // for JSON serialization into the inputMessages payload field.
 type inputMessage struct {
@@ -219,8 +635,9 @@ type inputMessage struct {
 }
 
 // populatePromptFields extracts prompt data from the model request and response
-// and sets the corresponding fields on the metering payload.
-func populatePromptFields(payload *MeteringPayload, req *model.Request, responseContent []model.Message) {
+// and sets the corresponding fields on the metering payload, limited to the
+// fields selected by scope.
+func populatePromptFields(payload *MeteringPayload, req *model.Request, responseContent []model.Message, scope CaptureScope) {
 	if req == nil {
 		return
 	}
@@ -229,7 +646,7 @@ func populatePromptFields(payload *MeteringPayload, req *model.Request, response
 	var inputMsgs []inputMessage
 
 	for _, msg := range req.Messages {
-		text := extractMessageText(msg)
+		text := captureMessageText(msg)
 		if text == "" {
 			continue
 		}
@@ -243,17 +660,17 @@ func populatePromptFields(payload *MeteringPayload, req *model.Request, response
 		}
 	}
 
-	if len(systemParts) > 0 {
+	if len(systemParts) > 0 && scope&CaptureSystemOnly != 0 {
 		payload.SystemPrompt = strings.Join(systemParts, "\n")
 	}
 
-	if len(inputMsgs) > 0 {
+	if len(inputMsgs) > 0 && scope&CaptureInputOnly != 0 {
 		if data, err := json.Marshal(inputMsgs); err == nil {
 			payload.InputMessages = string(data)
 		}
 	}
 
-	if len(responseContent) > 0 {
+	if len(responseContent) > 0 && scope&CaptureOutputOnly != 0 {
 		var parts []string
 		for i := range responseContent {
 			if t := extractMessageText(&responseContent[i]); t != "" {
@@ -0,0 +1,168 @@
+package revenium
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"goa.design/goa-ai/runtime/agent/model"
+)
+
+// fakeStreamer replays chunks and then returns io.EOF.
+type fakeStreamer struct {
+	chunks   []model.Chunk
+	metadata map[string]any
+}
+
+func (s *fakeStreamer) Recv() (model.Chunk, error) {
+	if len(s.chunks) == 0 {
+		return model.Chunk{}, io.EOF
+	}
+	chunk := s.chunks[0]
+	s.chunks = s.chunks[1:]
+	return chunk, nil
+}
+
+func (s *fakeStreamer) Close() error { return nil }
+
+func (s *fakeStreamer) Metadata() map[string]any { return s.metadata }
+
+// streamChunks returns a text chunk with usage followed by a terminal chunk.
+func streamChunks() []model.Chunk {
+	return []model.Chunk{
+		{
+			Type:       model.ChunkTypeText,
+			Message:    &model.Message{Role: model.ConversationRoleAssistant, Parts: []model.Part{model.TextPart{Text: "hi"}}},
+			UsageDelta: &model.TokenUsage{InputTokens: 10, OutputTokens: 2},
+		},
+		{Type: model.ChunkTypeStop, StopReason: "end_turn"},
+	}
+}
+
+func TestStreamerCloseBeforeTerminalChunk(t *testing.T) {
+	tests := []struct {
+		name        string
+		recv        int
+		wantInput   int
+		wantAbandon bool
+		wantReason  string
+	}{
+		{name: "closed before any chunk", recv: 0, wantInput: 0, wantAbandon: true, wantReason: StopReasonCancelled},
+		{name: "closed after usage", recv: 1, wantInput: 10, wantAbandon: true, wantReason: StopReasonCancelled},
+		{name: "drained", recv: 3, wantInput: 10, wantAbandon: false, wantReason: StopReasonEnd},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, store := newTestMeter(t)
+			client := &meteringClient{
+				inner:   &fakeModelClient{streamer: &fakeStreamer{chunks: streamChunks()}},
+				meter:   m,
+				modelID: "test-model",
+				agentID: "demo.assistant",
+			}
+			stream, err := client.Stream(context.Background(), &model.Request{})
+			if err != nil {
+				t.Fatalf("Stream: %v", err)
+			}
+			for range tt.recv {
+				if _, err := stream.Recv(); err != nil {
+					break
+				}
+			}
+			if err := stream.Close(); err != nil {
+				t.Fatalf("Close: %v", err)
+			}
+			m.Flush()
+
+			payloads := store.All()
+			if len(payloads) != 1 {
+				t.Fatalf("got %d payloads, want 1", len(payloads))
+			}
+			p := payloads[0]
+			if p.Abandoned != tt.wantAbandon {
+				t.Errorf("Abandoned = %v, want %v", p.Abandoned, tt.wantAbandon)
+			}
+			if p.StopReason != tt.wantReason {
+				t.Errorf("StopReason = %q, want %q", p.StopReason, tt.wantReason)
+			}
+			if p.InputTokenCount != tt.wantInput {
+				t.Errorf("InputTokenCount = %d, want %d", p.InputTokenCount, tt.wantInput)
+			}
+		})
+	}
+}
+
+// streamOnce drains a metered stream over inner and returns its payload.
+func streamOnce(t *testing.T, inner *fakeStreamer) MeteringPayload {
+	t.Helper()
+	m, store := newTestMeter(t)
+	client := &meteringClient{inner: &fakeModelClient{streamer: inner}, meter: m, modelID: "test-model"}
+	stream, err := client.Stream(context.Background(), &model.Request{})
+	if err != nil {
+		t.Fatalf("Stream: %v", err)
+	}
+	for {
+		if _, err := stream.Recv(); err != nil {
+			break
+		}
+	}
+	if err := stream.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	m.Flush()
+	payloads := store.All()
+	if len(payloads) != 1 {
+		t.Fatalf("got %d payloads, want 1", len(payloads))
+	}
+	return payloads[0]
+}
+
+func TestStreamMetadataProviderRequestID(t *testing.T) {
+	payload := streamOnce(t, &fakeStreamer{
+		chunks:   streamChunks(),
+		metadata: map[string]any{MetadataProviderRequestID: "req_abc123"},
+	})
+	if payload.ProviderRequestID != "req_abc123" {
+		t.Errorf("ProviderRequestID = %q, want req_abc123", payload.ProviderRequestID)
+	}
+}
+
+func TestStreamMetadataProviderRetries(t *testing.T) {
+	for _, retries := range []any{2, int64(2), float64(2)} {
+		payload := streamOnce(t, &fakeStreamer{
+			chunks:   streamChunks(),
+			metadata: map[string]any{MetadataProviderRetries: retries},
+		})
+		if payload.ProviderRetries != 2 {
+			t.Errorf("ProviderRetries from %T = %d, want 2", retries, payload.ProviderRetries)
+		}
+	}
+	if payload := streamOnce(t, &fakeStreamer{chunks: streamChunks()}); payload.ProviderRetries != 0 {
+		t.Errorf("ProviderRetries without metadata = %d, want 0", payload.ProviderRetries)
+	}
+}
+
+func TestStreamerDoubleClose(t *testing.T) {
+	m, store := newTestMeter(t)
+	client := &meteringClient{
+		inner:   &fakeModelClient{streamer: &fakeStreamer{chunks: streamChunks()}},
+		meter:   m,
+		modelID: "test-model",
+	}
+	stream, err := client.Stream(context.Background(), &model.Request{})
+	if err != nil {
+		t.Fatalf("Stream: %v", err)
+	}
+	if _, err := stream.Recv(); err != nil {
+		t.Fatalf("Recv: %v", err)
+	}
+	for range 2 {
+		if err := stream.Close(); err != nil {
+			t.Fatalf("Close: %v", err)
+		}
+	}
+	m.Flush()
+	if n := store.Len(); n != 1 {
+		t.Errorf("got %d payloads after two Closes, want 1", n)
+	}
+}
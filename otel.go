@@ -0,0 +1,54 @@
+package revenium
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+const instrumentationName = "github.com/revenium/revenium-middleware-goa"
+
+// otelInstruments holds the OpenTelemetry instruments recorded for each
+// metered completion.
+type otelInstruments struct {
+	completions metric.Int64Counter
+	tokens      metric.Int64Histogram
+	duration    metric.Int64Histogram
+}
+
+// newOtelInstruments creates the metering instruments from provider.
+func newOtelInstruments(provider metric.MeterProvider) (*otelInstruments, error) {
+	meter := provider.Meter(instrumentationName, metric.WithInstrumentationVersion(middlewareVersion))
+	completions, err := meter.Int64Counter("revenium.completions",
+		metric.WithDescription("Number of metered LLM completions."),
+		metric.WithUnit("{completion}"))
+	if err != nil {
+		return nil, err
+	}
+	tokens, err := meter.Int64Histogram("revenium.completion.tokens",
+		metric.WithDescription("Total tokens per metered LLM completion."),
+		metric.WithUnit("{token}"))
+	if err != nil {
+		return nil, err
+	}
+	duration, err := meter.Int64Histogram("revenium.completion.duration",
+		metric.WithDescription("Request duration of metered LLM completions."),
+		metric.WithUnit("ms"))
+	if err != nil {
+		return nil, err
+	}
+	return &otelInstruments{completions: completions, tokens: tokens, duration: duration}, nil
+}
+
+// record adds a metered completion to the instruments.
+func (o *otelInstruments) record(ctx context.Context, payload *MeteringPayload) {
+	attrs := metric.WithAttributes(
+		attribute.String("model", payload.Model),
+		attribute.String("provider", payload.Provider),
+		attribute.String("environment", payload.Environment),
+	)
+	o.completions.Add(ctx, 1, attrs)
+	o.tokens.Record(ctx, int64(payload.TotalTokenCount), attrs)
+	o.duration.Record(ctx, payload.RequestDuration, attrs)
+}
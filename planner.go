@@ -3,8 +3,6 @@ package revenium
 import (
 	"context"
 
-	"github.com/google/uuid"
-
 	"goa.design/goa-ai/runtime/agent/model"
 	"goa.design/goa-ai/runtime/agent/planner"
 	"goa.design/goa-ai/runtime/agent/run"
@@ -23,6 +21,10 @@ type MeteringPlanner struct {
 	// AgentID identifies the agent for squad detection and trace metadata.
 	AgentID string
 
+	// AgentVersion identifies the deployed agent version or build (e.g., for
+	// comparing canary and stable releases). Reported as agentVersion when set.
+	AgentVersion string
+
 	// Provider identifies the LLM provider (e.g., "OpenAI", "Anthropic").
 	// If empty, defaults to "unknown".
 	Provider string
@@ -36,14 +38,32 @@ type MeteringPlanner struct {
 	// output responses in metering payloads. Disabled by default since
 	// prompts may contain sensitive data.
 	CapturePrompts bool
+
+	// MeteringContext holds default per-request metering metadata (organization,
+	// subscription, product, subscriber) for runs planned by this planner. It is
+	// seeded into the planning context only when the caller has not already set
+	// a MeteringContext, which suits single-tenant deployments with static
+	// attribution.
+	MeteringContext *MeteringContext
 }
 
 func (p *MeteringPlanner) PlanStart(ctx context.Context, input *planner.PlanInput) (*planner.PlanResult, error) {
-	ctx = p.ensureTraceContext(ctx, input.RunContext)
+	if err := ctx.Err(); err != nil {
+		p.Meter.logger.Debug("skipping metering setup for run=%s: %v", input.RunContext.RunID, err)
+		return p.Inner.PlanStart(ctx, input)
+	}
+	ctx = p.ensureTraceContext(ctx, input.RunContext, PlanPhaseStart)
+	if p.Meter.ignoresAgent(p.AgentID) {
+		// Keep the trace context so child runs still correlate, but leave
+		// model clients unwrapped.
+		p.Meter.ignoreRun(input.RunContext.RunID)
+		return p.Inner.PlanStart(ctx, input)
+	}
 	input.Agent = &meteringPlannerContext{
 		PlannerContext: input.Agent,
 		meter:          p.Meter,
 		agentID:        p.AgentID,
+		agentVersion:   p.AgentVersion,
 		provider:       p.resolveProvider(),
 		modelName:      p.ModelName,
 		capturePrompts: p.CapturePrompts,
@@ -52,11 +72,20 @@ func (p *MeteringPlanner) PlanStart(ctx context.Context, input *planner.PlanInpu
 }
 
 func (p *MeteringPlanner) PlanResume(ctx context.Context, input *planner.PlanResumeInput) (*planner.PlanResult, error) {
-	ctx = p.ensureTraceContext(ctx, input.RunContext)
+	if err := ctx.Err(); err != nil {
+		p.Meter.logger.Debug("skipping metering setup for run=%s: %v", input.RunContext.RunID, err)
+		return p.Inner.PlanResume(ctx, input)
+	}
+	ctx = p.ensureTraceContext(ctx, input.RunContext, PlanPhaseResume)
+	if p.Meter.ignoresAgent(p.AgentID) {
+		p.Meter.ignoreRun(input.RunContext.RunID)
+		return p.Inner.PlanResume(ctx, input)
+	}
 	input.Agent = &meteringPlannerContext{
 		PlannerContext: input.Agent,
 		meter:          p.Meter,
 		agentID:        p.AgentID,
+		agentVersion:   p.AgentVersion,
 		provider:       p.resolveProvider(),
 		modelName:      p.ModelName,
 		capturePrompts: p.CapturePrompts,
@@ -71,41 +100,58 @@ func (p *MeteringPlanner) resolveProvider() string {
 	return "unknown"
 }
 
-func (p *MeteringPlanner) ensureTraceContext(ctx context.Context, rc run.Context) context.Context {
-	existing := GetTraceContext(ctx)
+func (p *MeteringPlanner) ensureTraceContext(ctx context.Context, rc run.Context, phase string) context.Context {
+	if p.MeteringContext != nil && p.Meter.meteringContext(ctx) == nil {
+		ctx = WithMeteringContext(ctx, p.MeteringContext)
+	}
+	if p.Meter.cfg.RunSessions && rc.SessionID != "" && sessionID(ctx) == "" {
+		ctx = WithSession(ctx, rc.SessionID)
+	}
 
 	tc := &TraceContext{
 		TraceType:     "agent",
 		TransactionID: rc.RunID,
-		Squad:         ResolveSquad(p.Meter.cfg, p.AgentID),
+		ParentTxnID:   rc.ParentRunID,
+		Squad:         ResolveSquadContext(ctx, p.Meter.cfg, p.AgentID),
+		PlanPhase:     phase,
+		Step:          string(rc.Tool),
 	}
 
-	// If a TraceContext already exists, inherit its TraceID (allows shared tracing)
-	if existing != nil && existing.TraceID != "" {
+	switch existing := p.Meter.traceContext(ctx); {
+	case isRootTrace(ctx):
+		// Forced top-level run: ignore the runtime's parent and any inherited
+		// trace. PlanResume keeps the trace this run registered at PlanStart.
+		tc.ParentTxnID = ""
+		if current, ok := p.Meter.LookupTrace(rc.RunID); ok && phase == PlanPhaseResume {
+			tc.TraceID = current
+		} else {
+			tc.TraceID = p.Meter.newID()
+		}
+		p.Meter.logger.Debug("starting root trace: run=%s trace=%s", rc.RunID, tc.TraceID)
+	case existing != nil && existing.TraceID != "":
+		// If a TraceContext already exists, inherit its TraceID (allows shared tracing).
+		// This also covers top-level runs whose caller seeded the context with
+		// WithTraceContext to continue an upstream correlation ID.
 		tc.TraceID = existing.TraceID
 		tc.TraceName = existing.TraceName
-		// For child runs, also set parent transaction
-		if rc.ParentRunID != "" {
-			tc.ParentTxnID = rc.ParentRunID
-		}
-		p.Meter.RegisterTrace(rc.RunID, tc.TraceID)
-		return WithTraceContext(ctx, tc)
-	}
-
-	if rc.ParentRunID == "" {
-		// Top-level run: generate a new traceID and register it.
-		tc.TraceID = uuid.New().String()
-		p.Meter.RegisterTrace(rc.RunID, tc.TraceID)
-	} else {
-		// Child run: inherit the parent's traceID and set ParentTxnID.
+		p.Meter.logger.Debug("continuing existing trace: run=%s trace=%s", rc.RunID, tc.TraceID)
+	case rc.ParentRunID == "":
+		// Top-level run: generate a new traceID.
+		tc.TraceID = p.Meter.newID()
+	default:
+		// Child run: inherit the parent's traceID.
 		if parentTraceID, ok := p.Meter.LookupTrace(rc.ParentRunID); ok {
 			tc.TraceID = parentTraceID
 		} else {
 			// Fallback: parent trace not found, generate new traceID.
 			p.Meter.logger.Warn("parent trace not found for run=%s parent=%s, generating new traceID", rc.RunID, rc.ParentRunID)
-			tc.TraceID = uuid.New().String()
+			tc.TraceID = p.Meter.newID()
 		}
-		tc.ParentTxnID = rc.ParentRunID
+	}
+
+	// Register once per call, and skip the write entirely when the mapping is
+	// unchanged (e.g., every PlanResume of the same run).
+	if current, ok := p.Meter.LookupTrace(rc.RunID); !ok || current != tc.TraceID {
 		p.Meter.RegisterTrace(rc.RunID, tc.TraceID)
 	}
 
@@ -118,6 +164,7 @@ type meteringPlannerContext struct {
 	planner.PlannerContext
 	meter          *Meter
 	agentID        string
+	agentVersion   string
 	provider       string
 	modelName      string
 	capturePrompts bool
@@ -138,6 +185,7 @@ func (m *meteringPlannerContext) ModelClient(id string) (model.Client, bool) {
 		meter:          m.meter,
 		modelID:        modelID,
 		agentID:        m.agentID,
+		agentVersion:   m.agentVersion,
 		provider:       m.provider,
 		capturePrompts: m.capturePrompts,
 	}, true
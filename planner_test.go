@@ -0,0 +1,243 @@
+package revenium
+
+import (
+	"context"
+	"testing"
+
+	"goa.design/goa-ai/runtime/agent/model"
+	"goa.design/goa-ai/runtime/agent/planner"
+	"goa.design/goa-ai/runtime/agent/run"
+)
+
+// newTestMeter returns a Meter that stores payloads in memory.
+func newTestMeter(t *testing.T, opts ...Option) (*Meter, *InMemoryStore) {
+	t.Helper()
+	store := NewInMemoryStore()
+	m, err := NewMeter(append([]Option{WithTransport(store)}, opts...)...)
+	if err != nil {
+		t.Fatalf("NewMeter: %v", err)
+	}
+	t.Cleanup(func() { _ = m.Close(context.Background()) })
+	return m, store
+}
+
+// fakeModelClient returns a fixed response from Complete.
+type fakeModelClient struct {
+	resp     *model.Response
+	err      error
+	streamer model.Streamer
+}
+
+func (c *fakeModelClient) Complete(context.Context, *model.Request) (*model.Response, error) {
+	return c.resp, c.err
+}
+
+func (c *fakeModelClient) Stream(context.Context, *model.Request) (model.Streamer, error) {
+	return c.streamer, c.err
+}
+
+// fakePlannerContext serves a single model client. Other PlannerContext
+// methods are not used by the tests and panic through the nil embedding.
+type fakePlannerContext struct {
+	planner.PlannerContext
+	client model.Client
+}
+
+func (c *fakePlannerContext) ModelClient(string) (model.Client, bool) {
+	return c.client, c.client != nil
+}
+
+// fakePlanner records the context it planned with and completes one model
+// call through the planner context.
+type fakePlanner struct {
+	ctx context.Context
+}
+
+func (p *fakePlanner) PlanStart(ctx context.Context, input *planner.PlanInput) (*planner.PlanResult, error) {
+	return p.plan(ctx, input.Agent)
+}
+
+func (p *fakePlanner) PlanResume(ctx context.Context, input *planner.PlanResumeInput) (*planner.PlanResult, error) {
+	return p.plan(ctx, input.Agent)
+}
+
+func (p *fakePlanner) plan(ctx context.Context, agent planner.PlannerContext) (*planner.PlanResult, error) {
+	p.ctx = ctx
+	if client, ok := agent.ModelClient("test-model"); ok {
+		if _, err := client.Complete(ctx, &model.Request{}); err != nil {
+			return nil, err
+		}
+	}
+	return &planner.PlanResult{}, nil
+}
+
+// usageClient returns a client that reports a small completion.
+func usageClient() *fakeModelClient {
+	return &fakeModelClient{resp: &model.Response{
+		Usage:      model.TokenUsage{Model: "test-model", InputTokens: 10, OutputTokens: 5},
+		StopReason: "end_turn",
+	}}
+}
+
+// planOnce runs PlanStart for agentID and rc and returns the single payload
+// it metered.
+func planOnce(t *testing.T, ctx context.Context, m *Meter, store *InMemoryStore, agentID string, rc run.Context) MeteringPayload {
+	t.Helper()
+	p := &MeteringPlanner{Inner: &fakePlanner{}, Meter: m, AgentID: agentID}
+	input := &planner.PlanInput{RunContext: rc, Agent: &fakePlannerContext{client: usageClient()}}
+	if _, err := p.PlanStart(ctx, input); err != nil {
+		t.Fatalf("PlanStart: %v", err)
+	}
+	m.Flush()
+	payloads := store.All()
+	if len(payloads) != 1 {
+		t.Fatalf("got %d payloads, want 1", len(payloads))
+	}
+	return payloads[0]
+}
+
+func TestPlanStartContinuesSeededTrace(t *testing.T) {
+	m, store := newTestMeter(t)
+	ctx := WithTraceContext(context.Background(), &TraceContext{
+		TraceID:   "upstream-123",
+		TraceName: "checkout",
+		TraceType: "workflow",
+	})
+
+	payload := planOnce(t, ctx, m, store, "demo.assistant", run.Context{RunID: "run-1"})
+	if payload.TraceID != "upstream-123" {
+		t.Errorf("payload trace = %q, want upstream-123", payload.TraceID)
+	}
+	if payload.TraceName != "checkout" {
+		t.Errorf("payload trace name = %q, want checkout", payload.TraceName)
+	}
+	if payload.TraceType != "agent" {
+		t.Errorf("payload trace type = %q, want agent", payload.TraceType)
+	}
+	if payload.TransactionID != "run-1" {
+		t.Errorf("payload transaction = %q, want run-1", payload.TransactionID)
+	}
+	if got, ok := m.LookupTrace("run-1"); !ok || got != "upstream-123" {
+		t.Errorf("LookupTrace(run-1) = %q, %v; want upstream-123, true", got, ok)
+	}
+}
+
+func TestPlanStartChildInheritsRegisteredTrace(t *testing.T) {
+	m, store := newTestMeter(t)
+	ctx := WithTraceContext(context.Background(), &TraceContext{TraceID: "upstream-123"})
+	planOnce(t, ctx, m, store, "demo.assistant", run.Context{RunID: "parent"})
+	store.Reset()
+
+	payload := planOnce(t, context.Background(), m, store, "demo.worker", run.Context{RunID: "child", ParentRunID: "parent"})
+	if payload.TraceID != "upstream-123" {
+		t.Errorf("child trace = %q, want upstream-123", payload.TraceID)
+	}
+	if payload.ParentTxnID != "parent" {
+		t.Errorf("child parent transaction = %q, want parent", payload.ParentTxnID)
+	}
+	if got, _ := m.LookupTrace("child"); got != "upstream-123" {
+		t.Errorf("LookupTrace(child) = %q, want upstream-123", got)
+	}
+}
+
+func TestEnsureTraceContextRegistration(t *testing.T) {
+	m, _ := newTestMeter(t)
+	p := &MeteringPlanner{Inner: &fakePlanner{}, Meter: m, AgentID: "demo.assistant"}
+	rc := run.Context{RunID: "run-1"}
+
+	ctx := p.ensureTraceContext(context.Background(), rc, PlanPhaseStart)
+	first := m.traceContext(ctx).TraceID
+	if got, ok := m.LookupTrace("run-1"); !ok || got != first {
+		t.Fatalf("after PlanStart LookupTrace = %q, %v; want %q, true", got, ok, first)
+	}
+
+	// Resuming the same run under its own context keeps the mapping.
+	for range 3 {
+		ctx = p.ensureTraceContext(ctx, rc, PlanPhaseResume)
+		if got := m.traceContext(ctx).TraceID; got != first {
+			t.Fatalf("PlanResume trace = %q, want %q", got, first)
+		}
+	}
+	if got, _ := m.LookupTrace("run-1"); got != first {
+		t.Errorf("after PlanResume LookupTrace = %q, want %q", got, first)
+	}
+
+	// A different trace for the same run replaces the mapping.
+	seeded := WithTraceContext(context.Background(), &TraceContext{TraceID: "upstream-123"})
+	p.ensureTraceContext(seeded, rc, PlanPhaseResume)
+	if got, _ := m.LookupTrace("run-1"); got != "upstream-123" {
+		t.Errorf("after reseeding LookupTrace = %q, want upstream-123", got)
+	}
+}
+
+func BenchmarkEnsureTraceContextResume(b *testing.B) {
+	m, err := NewMeter(WithTransport(NewInMemoryStore()))
+	if err != nil {
+		b.Fatalf("NewMeter: %v", err)
+	}
+	defer m.Close(context.Background())
+	p := &MeteringPlanner{Inner: &fakePlanner{}, Meter: m, AgentID: "demo.assistant"}
+	rc := run.Context{RunID: "run-1"}
+	ctx := p.ensureTraceContext(context.Background(), rc, PlanPhaseStart)
+
+	b.ReportAllocs()
+	for b.Loop() {
+		p.ensureTraceContext(ctx, rc, PlanPhaseResume)
+	}
+}
+
+func TestPlanWithCancelledContext(t *testing.T) {
+	m, store := newTestMeter(t)
+	inner := &fakePlanner{}
+	p := &MeteringPlanner{Inner: inner, Meter: m, AgentID: "demo.assistant"}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	agent := &fakePlannerContext{client: usageClient()}
+	start := &planner.PlanInput{RunContext: run.Context{RunID: "run-1"}, Agent: agent}
+	if _, err := p.PlanStart(ctx, start); err != nil {
+		t.Fatalf("PlanStart: %v", err)
+	}
+	resume := &planner.PlanResumeInput{RunContext: run.Context{RunID: "run-1"}, Agent: agent}
+	if _, err := p.PlanResume(ctx, resume); err != nil {
+		t.Fatalf("PlanResume: %v", err)
+	}
+	m.Flush()
+
+	if start.Agent != agent || resume.Agent != agent {
+		t.Error("planner context was wrapped for a cancelled run")
+	}
+	if tc := m.traceContext(inner.ctx); tc != nil {
+		t.Errorf("inner planner got trace context %+v, want none", tc)
+	}
+	if _, ok := m.LookupTrace("run-1"); ok {
+		t.Error("trace registered for a cancelled run")
+	}
+	if n := store.Len(); n != 0 {
+		t.Errorf("got %d payloads, want 0", n)
+	}
+}
+
+func TestRunSessionsOptIn(t *testing.T) {
+	rc := run.Context{RunID: "run-1", SessionID: "runtime-session"}
+	tests := []struct {
+		name string
+		opts []Option
+		ctx  context.Context
+		want string
+	}{
+		{"off by default", nil, context.Background(), ""},
+		{"explicit session", nil, WithSession(context.Background(), "chat-1"), "chat-1"},
+		{"run sessions", []Option{WithRunSessions(true)}, context.Background(), "runtime-session"},
+		{"explicit session wins", []Option{WithRunSessions(true)}, WithSession(context.Background(), "chat-1"), "chat-1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, store := newTestMeter(t, tt.opts...)
+			payload := planOnce(t, tt.ctx, m, store, "demo.assistant", rc)
+			if payload.SessionID != tt.want {
+				t.Errorf("SessionID = %q, want %q", payload.SessionID, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package revenium
+
+import "errors"
+
+// queueSlotsPerWorker sizes the WithMaxConcurrency queue relative to the
+// number of workers.
+const queueSlotsPerWorker = 64
+
+// Reasons dispatch passes to sendJob.drop.
+var (
+	errQueueFull   = errors.New("send queue full")
+	errQueueClosed = errors.New("meter closed")
+)
+
+// sendJob is a registered send waiting to run: a payload delivery or a shadow
+// send. Exactly one of run or drop is called, and either marks the send
+// finished with m.end.
+type sendJob struct {
+	run  func()
+	drop func(err error)
+}
+
+// startWorkers starts n workers draining m.queue. They exit once Close has
+// closed the queue and the jobs left in it have run.
+func (m *Meter) startWorkers(n int) {
+	m.queue = make(chan sendJob, n*queueSlotsPerWorker)
+	for range n {
+		go func() {
+			for job := range m.queue {
+				job.run()
+			}
+		}()
+	}
+}
+
+// stopWorkers closes the worker queue. Jobs already queued still run, so
+// under WithCancellableShutdown they see the aborted context and are dropped.
+func (m *Meter) stopWorkers() {
+	m.queueMu.Lock()
+	defer m.queueMu.Unlock()
+	if !m.queueStopped {
+		m.queueStopped = true
+		close(m.queue)
+	}
+}
+
+// dispatch runs job on a worker when WithMaxConcurrency is set, and on a new
+// goroutine otherwise. It reports false when the job was dropped instead,
+// with errQueueFull or errQueueClosed.
+func (m *Meter) dispatch(job sendJob) bool {
+	if m.queue == nil {
+		go job.run()
+		return true
+	}
+	m.queueMu.RLock()
+	defer m.queueMu.RUnlock()
+	if m.queueStopped {
+		job.drop(errQueueClosed)
+		return false
+	}
+	select {
+	case m.queue <- job:
+		return true
+	default:
+		job.drop(errQueueFull)
+		return false
+	}
+}
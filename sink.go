@@ -24,6 +24,27 @@ func (s *MeteringSink) Send(ctx context.Context, event stream.Event) error {
 		return s.Inner.Send(ctx, event)
 	}
 
+	// Some runtimes emit the same workflow phase more than once; pass repeats
+	// through without cleaning up or logging again.
+	if wf, ok := event.(stream.Workflow); ok &&
+		s.Meter.repeatedPhase(wf.RunID(), wf.Data.Phase, isTerminalPhase(wf.Data.Phase)) {
+		return s.Inner.Send(ctx, event)
+	}
+
+	// Runs of ignored agents only keep trace bookkeeping.
+	if s.Meter.isIgnoredRun(event.RunID()) {
+		switch e := event.(type) {
+		case stream.Workflow:
+			if isTerminalPhase(e.Data.Phase) {
+				s.Meter.UnregisterTrace(e.RunID())
+				s.Meter.ignored.Delete(e.RunID())
+			}
+		case stream.ChildRunLinked:
+			s.linkChild(ctx, e)
+		}
+		return s.Inner.Send(ctx, event)
+	}
+
 	switch e := event.(type) {
 	case stream.ToolStart:
 		s.Meter.logger.Debug("tool start: %s (call_id=%s)", e.Data.ToolName, e.Data.ToolCallID)
@@ -31,25 +52,27 @@ func (s *MeteringSink) Send(ctx context.Context, event stream.Event) error {
 	case stream.ToolEnd:
 		s.Meter.logger.Debug("tool end: %s (call_id=%s, duration=%s)",
 			e.Data.ToolName, e.Data.ToolCallID, e.Data.Duration)
+		if e.Data.Error != nil {
+			s.Meter.recordToolError(e.RunID())
+			s.Meter.logger.Debug("tool error: %s (call_id=%s, run=%s): %s",
+				e.Data.ToolName, e.Data.ToolCallID, e.RunID(), e.Data.Error.Message)
+		}
 
 	case stream.Workflow:
 		s.Meter.logger.Debug("workflow phase: %s (status=%s)", e.Data.Phase, e.Data.Status)
 		// Clean up trace registry on terminal workflow phases.
-		switch e.Data.Phase {
-		case "completed", "failed", "canceled":
+		if isTerminalPhase(e.Data.Phase) {
 			s.Meter.UnregisterTrace(e.RunID())
+			if n := s.Meter.takeToolErrors(e.RunID()); n > 0 {
+				s.Meter.logger.Debug("run %s %s with %d tool error(s)", e.RunID(), e.Data.Phase, n)
+			}
 		}
 
 	case stream.ChildRunLinked:
-		s.Meter.logger.Debug("child run linked: agent=%s run=%s (parent_call=%s)",
-			e.Data.ChildAgentID, e.Data.ChildRunID, e.Data.ToolCallID)
-		// Pre-register the child run's trace mapping so the child planner
-		// can inherit the parent's traceID before its PlanStart runs.
-		if tc := GetTraceContext(ctx); tc != nil {
-			s.Meter.RegisterTrace(e.Data.ChildRunID, tc.TraceID)
-			s.Meter.logger.Debug("pre-registered child trace: child_run=%s trace=%s (parent_run=%s)",
-				e.Data.ChildRunID, tc.TraceID, e.RunID())
-		}
+		s.Meter.logger.Debug("child run linked: agent=%s squad=%s run=%s (parent_call=%s)",
+			e.Data.ChildAgentID, ResolveSquadContext(ctx, s.Meter.cfg, string(e.Data.ChildAgentID)),
+			e.Data.ChildRunID, e.Data.ToolCallID)
+		s.linkChild(ctx, e)
 
 	case stream.Usage:
 		s.Meter.logger.Debug("usage: model=%s input=%d output=%d total=%d",
@@ -62,6 +85,30 @@ func (s *MeteringSink) Send(ctx context.Context, event stream.Event) error {
 	return s.Inner.Send(ctx, event)
 }
 
+// isTerminalPhase reports whether a workflow phase ends the run.
+func isTerminalPhase(phase string) bool {
+	switch phase {
+	case "completed", "failed", "canceled":
+		return true
+	default:
+		return false
+	}
+}
+
+// linkChild pre-registers the child run's trace mapping so the child planner
+// can inherit the parent's traceID before its PlanStart runs, and marks the
+// child run ignored when its agent matches WithIgnoredAgents.
+func (s *MeteringSink) linkChild(ctx context.Context, e stream.ChildRunLinked) {
+	if s.Meter.ignoresAgent(string(e.Data.ChildAgentID)) {
+		s.Meter.ignoreRun(e.Data.ChildRunID)
+	}
+	if tc := s.Meter.traceContext(ctx); tc != nil {
+		s.Meter.RegisterTrace(e.Data.ChildRunID, tc.TraceID)
+		s.Meter.logger.Debug("pre-registered child trace: child_run=%s trace=%s (parent_run=%s)",
+			e.Data.ChildRunID, tc.TraceID, e.RunID())
+	}
+}
+
 func (s *MeteringSink) Close(ctx context.Context) error {
 	return s.Inner.Close(ctx)
 }
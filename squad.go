@@ -1,12 +1,30 @@
 package revenium
 
-import "strings"
+import (
+	"context"
+	"strings"
+)
+
+const defaultSquadDelimiter = "."
 
 // DetectSquad extracts the service prefix from an agent ID.
 // For example, "demo.assistant" returns "demo".
 func DetectSquad(agentID string) string {
-	if i := strings.Index(agentID, "."); i > 0 {
-		return agentID[:i]
+	return detectSquad(agentID, defaultSquadDelimiter, 1)
+}
+
+// detectSquad returns the first depth delimiter-separated segments of agentID.
+// The final segment is the agent name and is never part of the squad, so
+// "org.team.agent" yields "org" at depth 1 and "org.team" at depth 2 or more.
+// The whole ID is returned when it has no squad prefix.
+func detectSquad(agentID, delimiter string, depth int) string {
+	segments := strings.Split(agentID, delimiter)
+	keep := min(depth, len(segments)-1)
+	if keep < 1 {
+		return agentID
+	}
+	if squad := strings.Join(segments[:keep], delimiter); squad != "" {
+		return squad
 	}
 	return agentID
 }
@@ -18,8 +36,30 @@ func CompositeSquadName(squads ...string) string {
 
 // ResolveSquad returns the configured squad override, or auto-detects from the agent ID.
 func ResolveSquad(cfg *Config, agentID string) string {
-	if cfg != nil && cfg.Squad != "" {
+	if cfg == nil {
+		return DetectSquad(agentID)
+	}
+	if cfg.Squad != "" {
 		return cfg.Squad
 	}
-	return DetectSquad(agentID)
+	delimiter := cfg.SquadDelimiter
+	if delimiter == "" {
+		delimiter = defaultSquadDelimiter
+	}
+	depth := cfg.SquadDepth
+	if depth < 1 {
+		depth = 1
+	}
+	return detectSquad(agentID, delimiter, depth)
+}
+
+// ResolveSquadContext is like ResolveSquad but consults the configured
+// SquadResolver first, falling back to ResolveSquad when it returns empty.
+func ResolveSquadContext(ctx context.Context, cfg *Config, agentID string) string {
+	if cfg != nil && cfg.SquadResolver != nil {
+		if squad := cfg.SquadResolver(ctx, agentID); squad != "" {
+			return squad
+		}
+	}
+	return ResolveSquad(cfg, agentID)
 }
@@ -0,0 +1,65 @@
+package revenium
+
+import (
+	"context"
+	"testing"
+
+	"goa.design/goa-ai/runtime/agent/run"
+)
+
+func TestSquadDelimiterReachesPayload(t *testing.T) {
+	m, store := newTestMeter(t, WithSquadDelimiter("/"))
+	payload := planOnce(t, context.Background(), m, store, "billing/assistant", run.Context{RunID: "run-1"})
+	if payload.SquadID != "billing" || payload.SquadName != "billing" {
+		t.Errorf("squad = %q/%q, want billing/billing", payload.SquadID, payload.SquadName)
+	}
+}
+
+func TestSquadDepthReachesPayload(t *testing.T) {
+	m, store := newTestMeter(t, WithSquadDepth(2))
+	payload := planOnce(t, context.Background(), m, store, "org.team.agent", run.Context{RunID: "run-1"})
+	if payload.SquadID != "org.team" || payload.SquadName != "org.team" {
+		t.Errorf("squad = %q/%q, want org.team/org.team", payload.SquadID, payload.SquadName)
+	}
+}
+
+func TestDetectSquadDepth(t *testing.T) {
+	tests := []struct {
+		agentID string
+		depth   int
+		want    string
+	}{
+		{"org.team.agent", 1, "org"},
+		{"org.team.agent", 2, "org.team"},
+		{"org.team.agent", 5, "org.team"},
+		{"agent", 2, "agent"},
+	}
+	for _, tt := range tests {
+		if got := detectSquad(tt.agentID, ".", tt.depth); got != tt.want {
+			t.Errorf("detectSquad(%q, %d) = %q, want %q", tt.agentID, tt.depth, got, tt.want)
+		}
+	}
+}
+
+type squadKey struct{}
+
+func TestSquadResolverReachesPayload(t *testing.T) {
+	resolver := func(ctx context.Context, _ string) string {
+		squad, _ := ctx.Value(squadKey{}).(string)
+		return squad
+	}
+	m, store := newTestMeter(t, WithSquadResolver(resolver))
+
+	ctx := context.WithValue(context.Background(), squadKey{}, "payments")
+	payload := planOnce(t, ctx, m, store, "demo.assistant", run.Context{RunID: "run-1"})
+	if payload.SquadID != "payments" || payload.SquadName != "payments" {
+		t.Errorf("squad = %q/%q, want payments/payments", payload.SquadID, payload.SquadName)
+	}
+
+	// An empty result falls back to detection from the agent ID.
+	store.Reset()
+	payload = planOnce(t, context.Background(), m, store, "demo.assistant", run.Context{RunID: "run-2"})
+	if payload.SquadID != "demo" {
+		t.Errorf("fallback squad = %q, want demo", payload.SquadID)
+	}
+}
@@ -0,0 +1,161 @@
+package revenium
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Stats is a point-in-time snapshot of a Meter's delivery counters.
+type Stats struct {
+	// Sent is the number of payloads accepted by the Revenium API.
+	Sent uint64
+
+	// Failed is the number of payloads that could not be delivered after all
+	// retries (including payloads rejected by validation).
+	Failed uint64
+
+	// InFlight is the number of sends queued or in progress.
+	InFlight int64
+
+	// Requeued is the number of times a payload was re-queued after a
+	// connection failure during WithStartupGrace.
+	Requeued uint64
+
+	// SampledOut is the number of payloads skipped by WithSampleRate or
+	// WithSampleRates. They are not counted in Failed.
+	SampledOut uint64
+
+	// ShutdownDropped is the number of payloads dropped because they were
+	// sent after Close.
+	ShutdownDropped uint64
+
+	// ResultsDropped is the number of send results discarded because the
+	// result channel was full.
+	ResultsDropped uint64
+
+	// OversizeDropped is the number of payloads dropped for exceeding
+	// WithMaxBodyBytes. They are also counted in Failed.
+	OversizeDropped uint64
+
+	// BreakerRejected is the number of payloads dropped because the circuit
+	// breaker was open. They are also counted in Failed.
+	BreakerRejected uint64
+
+	// QueueDropped is the number of payloads dropped because the
+	// WithMaxConcurrency queue was full. They are also counted in Failed.
+	QueueDropped uint64
+
+	// BreakerState is the circuit breaker state (BreakerClosed, BreakerOpen,
+	// or BreakerHalfOpen), or empty when WithCircuitBreaker is not configured.
+	BreakerState string
+
+	// Panics is the number of panics recovered on send goroutines.
+	Panics uint64
+
+	// ToolErrors is the number of failed tool invocations observed by
+	// MeteringSink.
+	ToolErrors uint64
+
+	// RetryDelayTotal is the cumulative time delivery spent in backoff
+	// between retries, and RequestTimeTotal the cumulative time spent in the
+	// requests themselves. Together they separate a slow Revenium API from
+	// heavy backoff.
+	RetryDelayTotal  time.Duration
+	RequestTimeTotal time.Duration
+}
+
+// meterStats holds the live counters behind Stats.
+type meterStats struct {
+	sent            atomic.Uint64
+	failed          atomic.Uint64
+	requeued        atomic.Uint64
+	sampledOut      atomic.Uint64
+	shutdownDropped atomic.Uint64
+	resultsDropped  atomic.Uint64
+	oversize        atomic.Uint64
+	breakerReject   atomic.Uint64
+	queueDropped    atomic.Uint64
+	panics          atomic.Uint64
+	toolErrors      atomic.Uint64
+	lastSuccess     atomic.Int64 // Unix nanoseconds of the last 2xx response
+	retryDelay      atomic.Int64 // nanoseconds
+	requestTime     atomic.Int64 // nanoseconds
+}
+
+// Stats returns a snapshot of the meter's delivery counters.
+func (m *Meter) Stats() Stats {
+	stats := Stats{
+		Sent:            m.stats.sent.Load(),
+		Failed:          m.stats.failed.Load(),
+		InFlight:        m.inFlight.Load(),
+		Requeued:        m.stats.requeued.Load(),
+		SampledOut:      m.stats.sampledOut.Load(),
+		ShutdownDropped: m.stats.shutdownDropped.Load(),
+		ResultsDropped:  m.stats.resultsDropped.Load(),
+		OversizeDropped: m.stats.oversize.Load(),
+		BreakerRejected: m.stats.breakerReject.Load(),
+		QueueDropped:    m.stats.queueDropped.Load(),
+		Panics:          m.stats.panics.Load(),
+		ToolErrors:      m.stats.toolErrors.Load(),
+
+		RetryDelayTotal:  time.Duration(m.stats.retryDelay.Load()),
+		RequestTimeTotal: time.Duration(m.stats.requestTime.Load()),
+	}
+	if m.breaker != nil {
+		stats.BreakerState = m.breaker.currentState()
+	}
+	return stats
+}
+
+// LastSuccess returns when a payload was last accepted by the Revenium API, or
+// the zero time if no send has succeeded yet. It is a cheap liveness signal for
+// alerting when metering stops flowing.
+func (m *Meter) LastSuccess() time.Time {
+	ns := m.stats.lastSuccess.Load()
+	if ns == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, ns)
+}
+
+// SendResult describes the outcome of delivering one payload.
+type SendResult struct {
+	// Payload is the payload that was sent.
+	Payload *MeteringPayload
+
+	// Err is nil on success, or the final error after all retries.
+	Err error
+
+	// Retries is the number of attempts made after the first one.
+	Retries int
+
+	// Latency is the total time spent delivering the payload, including
+	// backoff between retries.
+	Latency time.Duration
+
+	// RetryDelay is the part of Latency spent in backoff between retries.
+	RetryDelay time.Duration
+
+	// RequestTime is the part of Latency spent sending requests.
+	RequestTime time.Duration
+}
+
+// Results returns the channel on which send results are published, or nil
+// when WithResultChannel is not configured. Results are dropped (and counted
+// in Stats().ResultsDropped) rather than blocking delivery when the channel is
+// full, so consumers should drain it promptly.
+func (m *Meter) Results() <-chan SendResult {
+	return m.results
+}
+
+// publishResult delivers a send result without blocking.
+func (m *Meter) publishResult(result SendResult) {
+	if m.results == nil {
+		return
+	}
+	select {
+	case m.results <- result:
+	default:
+		m.stats.resultsDropped.Add(1)
+	}
+}
@@ -0,0 +1,123 @@
+package revenium
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"math"
+	"net/mail"
+	"strings"
+)
+
+// Minimum length and Shannon entropy (bits per character) at which a
+// credential value is treated as a likely secret by WithSubscriberValidation.
+const (
+	secretMinLength  = 20
+	secretMinEntropy = 4.0
+)
+
+// secretPrefixes are prefixes of well-known API key and token formats.
+var secretPrefixes = []string{"sk-", "sk_", "pk_live_", "hak_", "ghp_", "gho_", "xoxb-", "xoxp-", "AKIA", "AIza"}
+
+// checkSubscribers applies WithSubscriberValidation to the payload's
+// subscribers. Malformed emails are logged; credential values that look like
+// secrets are logged and removed, keeping the credential name. Subscribers
+// are copied before being changed because they are shared across payloads.
+func (m *Meter) checkSubscribers(payload *MeteringPayload) {
+	if payload.Subscriber != nil {
+		payload.Subscriber = m.checkSubscriber(payload.Subscriber)
+	}
+	if len(payload.AdditionalSubscribers) == 0 {
+		return
+	}
+	subs := make([]*SubscriberResource, len(payload.AdditionalSubscribers))
+	for i, sub := range payload.AdditionalSubscribers {
+		if sub != nil {
+			sub = m.checkSubscriber(sub)
+		}
+		subs[i] = sub
+	}
+	payload.AdditionalSubscribers = subs
+}
+
+// checkSubscriber validates one subscriber, returning it unchanged or a copy
+// with a suspected secret credential value removed.
+func (m *Meter) checkSubscriber(sub *SubscriberResource) *SubscriberResource {
+	if sub.Email != "" && !validEmail(sub.Email) {
+		m.logger.Warn("subscriber %s has malformed email %s", logHash(sub.ID), logHash(sub.Email))
+	}
+	if sub.Credential == nil || !looksLikeSecret(sub.Credential.Value) {
+		return sub
+	}
+	m.logger.Warn("subscriber %s credential %q value looks like a secret; not sending it (send a hash or name instead)",
+		logHash(sub.ID), sub.Credential.Name)
+	sub = copySubscriber(sub)
+	sub.Credential.Value = ""
+	return sub
+}
+
+// logHash returns a short SHA-256 prefix of a subscriber ID or email for log
+// messages, so warnings can be correlated with a subscriber without writing
+// personal data to the logs.
+func logHash(value string) string {
+	if value == "" {
+		return `""`
+	}
+	sum := sha256.Sum256([]byte(value))
+	return "sha256:" + hex.EncodeToString(sum[:6])
+}
+
+// validEmail reports whether email is a bare RFC 5322 address with a dotted
+// domain, e.g. "user@example.com".
+func validEmail(email string) bool {
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email || addr.Name != "" {
+		return false
+	}
+	at := strings.LastIndexByte(email, '@')
+	return at > 0 && strings.Contains(email[at+1:], ".")
+}
+
+// looksLikeSecret reports whether value resembles an API key or token: a
+// well-known key prefix, or a long, high-entropy string with no spaces. Hex
+// strings are accepted, since they are the expected form of hashed values.
+func looksLikeSecret(value string) bool {
+	for _, prefix := range secretPrefixes {
+		if strings.HasPrefix(value, prefix) && len(value) >= secretMinLength {
+			return true
+		}
+	}
+	if len(value) < secretMinLength || strings.ContainsAny(value, " \t\n") || isHex(value) {
+		return false
+	}
+	return shannonEntropy(value) >= secretMinEntropy
+}
+
+// isHex reports whether s consists of hex digits, optionally grouped by
+// dashes as in a UUID.
+func isHex(s string) bool {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F' || c == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+// shannonEntropy returns the Shannon entropy of s in bits per byte.
+func shannonEntropy(s string) float64 {
+	var counts [256]int
+	for i := 0; i < len(s); i++ {
+		counts[s[i]]++
+	}
+	entropy := 0.0
+	n := float64(len(s))
+	for _, c := range counts {
+		if c == 0 {
+			continue
+		}
+		p := float64(c) / n
+		entropy -= p * math.Log2(p)
+	}
+	return entropy
+}
@@ -0,0 +1,34 @@
+package revenium
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheckSubscriberRedactsLogs(t *testing.T) {
+	m, _ := newTestMeter(t, WithSubscriberValidation(true))
+	buf := captureLog(t)
+
+	payload := testPayload()
+	payload.Subscriber = &SubscriberResource{
+		ID:         "user-8675309",
+		Email:      "jenny@invalid",
+		Credential: &CredentialResource{Name: "api", Value: "sk-abcdefghijklmnopqrstuvwxyz"},
+	}
+	m.checkSubscribers(payload)
+
+	out := buf.String()
+	for _, raw := range []string{"user-8675309", "jenny@invalid", "sk-abcdef"} {
+		if strings.Contains(out, raw) {
+			t.Errorf("log contains %q:\n%s", raw, out)
+		}
+	}
+	for _, hashed := range []string{logHash("user-8675309"), logHash("jenny@invalid")} {
+		if !strings.Contains(out, hashed) {
+			t.Errorf("log is missing %s:\n%s", hashed, out)
+		}
+	}
+	if payload.Subscriber.Credential.Value != "" {
+		t.Error("secret credential value was not removed")
+	}
+}
@@ -0,0 +1,14 @@
+package revenium
+
+import "context"
+
+// Transport delivers marshaled metering payloads to a destination other than
+// the Revenium HTTP API, such as a Kafka or NATS publisher feeding a
+// collector. Enrichment, validation, marshaling, and retries stay in the
+// Meter; only the final delivery is delegated.
+type Transport interface {
+	// Send delivers body, the JSON encoding of payload. Payload is provided
+	// for routing (e.g., as a message key) and must be treated as read-only.
+	// A non-nil error is retried with the meter's backoff policy.
+	Send(ctx context.Context, payload *MeteringPayload, body []byte) error
+}
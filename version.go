@@ -3,21 +3,52 @@ package revenium
 import (
 	"fmt"
 	"runtime/debug"
+	"strings"
 )
 
-const middlewareName = "goa-ai-revenium"
+const (
+	middlewareName = "goa-ai-revenium"
+	frameworkPath  = "goa.design/goa-ai"
+)
 
 var (
 	middlewareVersion = "0.1.0"
 	middlewareSource  string
 	userAgent         string
+	goVersion         = "unknown"
+	frameworkVersion  string // goa-ai module version, if in the build info
 )
 
 func init() {
-	goVersion := "unknown"
 	if info, ok := debug.ReadBuildInfo(); ok {
 		goVersion = info.GoVersion
+		for _, dep := range info.Deps {
+			if dep.Path != frameworkPath {
+				continue
+			}
+			if dep.Replace != nil && dep.Replace.Version != "" {
+				dep = dep.Replace
+			}
+			frameworkVersion = dep.Version
+			break
+		}
 	}
 	middlewareSource = fmt.Sprintf("%s/%s", middlewareName, middlewareVersion)
 	userAgent = fmt.Sprintf("%s/%s Go/%s", middlewareName, middlewareVersion, goVersion)
 }
+
+// validSourcePrefix reports whether prefix can be prepended to the middleware
+// source and User-Agent header: printable ASCII with no whitespace, quotes, or
+// header delimiters, e.g. "acme-platform/2.1".
+func validSourcePrefix(prefix string) bool {
+	if prefix == "" {
+		return false
+	}
+	for i := 0; i < len(prefix); i++ {
+		c := prefix[i]
+		if c <= ' ' || c >= 0x7f || strings.IndexByte(`"(),:;<=>?@[\]{}`, c) >= 0 {
+			return false
+		}
+	}
+	return true
+}